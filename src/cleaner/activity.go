@@ -0,0 +1,156 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// note body 中引用 resource 的格式: ":/<resource ID>", eg: ![](:/0123...) 和 [a.pdf](:/0123...).
+var resourceLinkRe = regexp.MustCompile(`:/([0-9a-f]{32})`)
+
+// DOC: Gets all folders.
+// https://joplinapp.org/api/references/rest_api/#get-folders
+func getAllFolders(ctx context.Context, req Client) (folders []Item, err error) {
+	var mark = true
+	for page := 1; mark; page++ {
+		url := fmt.Sprintf("http://localhost:%d/folders?fields=id,parent_id,title&order_by=id&limit=%d&page=%d", req.Port, pageLimit, page)
+		var resp joplinResponse
+		err := readRespBody(ctx, req, "GET", url, &resp)
+		if err != nil {
+			return nil, err
+		}
+
+		// joplin server return error.
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+
+		folders = append(folders, resp.Items...)
+		mark = resp.More
+	}
+
+	return folders, nil
+}
+
+// 正在被编辑的 notebook 中, resource 可能刚被删除引用又会被撤销, 或者还没有保存到 note 中.
+// 保留链接到 cutoff 之后有 note 活动的 notebooks 的 resources.
+// resource 和 notebook 的关系通过 note body 中的链接判断, 包括回收站中的 notes (即曾经引用过该 resource 的 notes).
+// notebook 的活动时间是其中所有 notes 最新的 updated_time.
+func skipActiveNotebookResources(ctx context.Context, req Client, resources map[string]Item, d Decisions, cutoff time.Time) error {
+	if len(resources) < 1 {
+		return nil
+	}
+
+	notes, err := getAllNotes(ctx, req, "id,parent_id,body,updated_time", true)
+	if err != nil {
+		return err
+	}
+
+	folders, err := getAllFolders(ctx, req)
+	if err != nil {
+		return err
+	}
+	titles := make(map[string]string)
+	for _, f := range folders {
+		titles[f.ID] = f.Title
+	}
+
+	activity := make(map[string]int64)  // notebook ID -> latest note updated_time
+	linked := make(map[string][]string) // resource ID -> notebook IDs
+	for _, n := range notes {
+		activity[n.ParentID] = max(activity[n.ParentID], n.UpdatedTime)
+		for _, m := range resourceLinkRe.FindAllStringSubmatch(n.Body, -1) {
+			if _, ok := resources[m[1]]; ok {
+				linked[m[1]] = append(linked[m[1]], n.ParentID)
+			}
+		}
+	}
+
+	for id, notebooks := range linked {
+		for _, nb := range notebooks {
+			t := time.UnixMilli(activity[nb])
+			if t.After(cutoff) {
+				d.Keep(resources, id, fmt.Sprintf("notebook %q has note activity at %s", titles[nb], t.Format(time.RFC3339)))
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// 通过 folder tree 解析 notebook path, eg: "Work/Clients".
+// 返回匹配的 folders 以及其所有 subfolders 的 IDs, 同名的 folders 都会匹配.
+func resolveFolderPath(folders []Item, path string) (map[string]bool, error) {
+	children := make(map[string][]Item) // parent ID -> folders, top-level 的 parent ID 为 ""
+	for _, f := range folders {
+		children[f.ParentID] = append(children[f.ParentID], f)
+	}
+
+	matched := []string{""}
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		var next []string
+		for _, parent := range matched {
+			for _, f := range children[parent] {
+				if f.Title == name {
+					next = append(next, f.ID)
+				}
+			}
+		}
+		if len(next) < 1 {
+			return nil, fmt.Errorf("notebook %q not found", path)
+		}
+		matched = next
+	}
+
+	ids := make(map[string]bool)
+	for len(matched) > 0 {
+		id := matched[len(matched)-1]
+		matched = matched[:len(matched)-1]
+		ids[id] = true
+		for _, f := range children[id] {
+			matched = append(matched, f.ID)
+		}
+	}
+	return ids, nil
+}
+
+// 保留链接自 path 及其 subfolders 中 notes 的 resources, 包括回收站中的 notes.
+func skipProtectedPathResources(ctx context.Context, req Client, resources map[string]Item, d Decisions, path string) error {
+	if len(resources) < 1 {
+		return nil
+	}
+
+	folders, err := getAllFolders(ctx, req)
+	if err != nil {
+		return err
+	}
+	protected, err := resolveFolderPath(folders, path)
+	if err != nil {
+		return err
+	}
+
+	notes, err := getAllNotes(ctx, req, "id,parent_id,body", true)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notes {
+		if !protected[n.ParentID] {
+			continue
+		}
+		for _, m := range resourceLinkRe.FindAllStringSubmatch(n.Body, -1) {
+			if _, ok := resources[m[1]]; ok {
+				reason := fmt.Sprintf("linked from note %s in protected path %q", n.ID, path)
+				req.logger().Printf("protect %s: %s\n", m[1], reason)
+				d.Keep(resources, m[1], reason)
+			}
+		}
+	}
+
+	return nil
+}
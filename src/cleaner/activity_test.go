@@ -0,0 +1,86 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSkipActiveNotebookResources(t *testing.T) {
+	now := time.Now()
+	id := func(i int) string { return fmt.Sprintf("%032x", i) }
+
+	var all []Item
+	for i := 0; i < 4; i++ {
+		all = append(all, Item{ID: id(i)})
+	}
+	m, req := newMockJoplin(t, all, nil)
+	m.folders = []Item{{ID: "active", Title: "Active"}, {ID: "idle", Title: "Idle"}}
+	m.notes = []Item{
+		{ID: "n1", ParentID: "active", Body: "![](:/" + id(0) + ")", UpdatedTime: now.Add(-30 * 24 * time.Hour).UnixMilli()},
+		{ID: "n2", ParentID: "active", UpdatedTime: now.Add(-time.Hour).UnixMilli()},
+		{ID: "n3", ParentID: "idle", Body: "[a.pdf](:/" + id(1) + ")", UpdatedTime: now.Add(-30 * 24 * time.Hour).UnixMilli()},
+	}
+
+	resources := make(map[string]Item)
+	for _, item := range all {
+		resources[item.ID] = item
+	}
+	d := make(Decisions)
+	err := skipActiveNotebookResources(context.Background(), req, resources, d, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有 id(0) 链接到了最近有活动的 notebook.
+	if _, ok := resources[id(0)]; ok || !d[id(0)].Keep {
+		t.Errorf("%s is in an active notebook, should be kept", id(0))
+	}
+	for i := 1; i < len(all); i++ {
+		if _, ok := resources[id(i)]; !ok {
+			t.Errorf("%s should not be kept: %s", id(i), d[id(i)].Reason)
+		}
+	}
+}
+
+func TestSkipProtectedPathResources(t *testing.T) {
+	id := func(i int) string { return fmt.Sprintf("%032x", i) }
+
+	var all []Item
+	for i := 0; i < 4; i++ {
+		all = append(all, Item{ID: id(i)})
+	}
+	m, req := newMockJoplin(t, all, nil)
+	m.folders = []Item{
+		{ID: "work", Title: "Work"},
+		{ID: "clients", ParentID: "work", Title: "Clients"},
+		{ID: "acme", ParentID: "clients", Title: "Acme"},
+		{ID: "other", Title: "Clients"}, // 同名但不在 path 中
+	}
+	m.notes = []Item{
+		{ID: "n1", ParentID: "clients", Body: "![](:/" + id(0) + ")"},
+		{ID: "n2", ParentID: "acme", Body: "[a.pdf](:/" + id(1) + ")"},
+		{ID: "n3", ParentID: "other", Body: "![](:/" + id(2) + ")"},
+		{ID: "n4", ParentID: "work", Body: "![](:/" + id(3) + ")"},
+	}
+
+	resources := make(map[string]Item)
+	for _, item := range all {
+		resources[item.ID] = item
+	}
+	d := make(Decisions)
+	if err := skipProtectedPathResources(context.Background(), req, resources, d, "Work/Clients"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, kept := range []bool{true, true, false, false} {
+		if _, ok := resources[id(i)]; ok == kept {
+			t.Errorf("%s: kept %v, want %v", id(i), !ok, kept)
+		}
+	}
+
+	if err := skipProtectedPathResources(context.Background(), req, resources, d, "Work/Nope"); err == nil {
+		t.Error("want error for a path that doesn't exist")
+	}
+}
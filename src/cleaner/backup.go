@@ -0,0 +1,136 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DOC: Gets the actual file associated with this resource.
+// https://joplinapp.org/api/references/rest_api/#get-resources-id-file
+// 下载到 dir/<id>.<file_extension>, 先写入临时文件, 下载完成后再 rename, 避免留下不完整的备份.
+// 下载没有 http client 的 Timeout, 只受 ctx 限制, 见 Client.downloadClient().
+// limit > 0 时, 文件超过 limit bytes 则停止下载并返回 error, 防止 size metadata 不准确时占满磁盘.
+func backupResource(ctx context.Context, req Client, dir string, item Item, limit int64) error {
+	url := fmt.Sprintf("http://localhost:%d/resources/%s/file", req.Port, item.ID)
+
+	r, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	resp, err := req.downloadClient().Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = checkResponse(resp); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, item.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // rename 成功之后 Remove 会失败, 忽略.
+
+	var body io.Reader = resp.Body
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	n, err := io.Copy(tmp, body)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if limit > 0 && n > limit {
+		tmp.Close()
+		return fmt.Errorf("file exceeds -max-download-size %d bytes", limit)
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), backupPath(dir, item))
+}
+
+func backupPath(dir string, item Item) string {
+	name := item.ID
+	if item.FileExtension != "" {
+		name += "." + item.FileExtension
+	}
+	return filepath.Join(dir, name)
+}
+
+// -backup-all-first: 使用 req.Concurrency 个 goroutine 备份所有 resources, 然后检查每个备份文件.
+// 任何一个失败都返回 error, 调用者不应删除任何 resource, 保证删除之前有完整的备份.
+// 超过 maxSize 的 resources 没有办法备份, 同样算作失败, 见 tooLargeToDownload().
+// 返回备份或检查失败的 resources.
+func backupAll(ctx context.Context, req Client, dir string, resources map[string]Item, maxSize int64) ([]DeleteFailure, error) {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []DeleteFailure
+	)
+
+	items := make(chan Item)
+	for i := 0; i < max(req.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				err := errTooLargeToDownload(item, maxSize)
+				if err == nil {
+					err = backupResource(ctx, req, dir, item, maxSize)
+				}
+				if err == nil {
+					err = verifyBackup(dir, item)
+				}
+				if err != nil {
+					mu.Lock()
+					failed = append(failed, newDeleteFailure(item.ID, "GET /resources/"+item.ID+"/file", err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, id := range SortedIDs(resources) {
+		items <- resources[id]
+	}
+	close(items)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("%d of %d backups failed, nothing is deleted", len(failed), len(resources))
+		return failed, err
+	}
+	req.logger().Printf("backed up %d resources to %s\n", len(resources), dir)
+	return nil, nil
+}
+
+// 备份文件存在, 并且大小和 resource 的 size 一致.
+func verifyBackup(dir string, item Item) error {
+	fi, err := os.Stat(backupPath(dir, item))
+	if err != nil {
+		return err
+	}
+	if fi.Size() != item.Size {
+		return fmt.Errorf("backup has %d bytes, resource size is %d", fi.Size(), item.Size)
+	}
+	return nil
+}
+
+// -max-download-size: 根据 size metadata 判断, 下载之前拒绝太大的 resources.
+// 正常情况下它们已经在 scan 时被保留了, 见 skipTooLargeToBackUp(), 这里只是以防万一.
+func errTooLargeToDownload(item Item, maxSize int64) error {
+	if maxSize <= 0 || item.Size <= maxSize {
+		return nil
+	}
+	return fmt.Errorf("%s exceeds -max-download-size, not backed up", FormatBytes(item.Size))
+}
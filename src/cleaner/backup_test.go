@@ -0,0 +1,241 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeleteResourcesBackupBeforeDelete(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events = make(map[string][]string) // resource ID -> "backup" / "delete" in order
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/resources/")
+		id, isFile := strings.CutSuffix(path, "/file")
+
+		mu.Lock()
+		switch {
+		case r.Method == http.MethodGet && isFile:
+			events[id] = append(events[id], "backup")
+		case r.Method == http.MethodDelete:
+			events[id] = append(events[id], "delete")
+		}
+		mu.Unlock()
+
+		if isFile {
+			time.Sleep(time.Millisecond) // 让下载比删除慢, 暴露顺序问题.
+			fmt.Fprint(w, "content of "+id)
+		}
+	}))
+	defer ts.Close()
+
+	req := testReq(ts)
+
+	resources := make(map[string]Item)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("%032x", i)
+		resources[id] = Item{ID: id, FileExtension: "png"}
+	}
+
+	dir := t.TempDir()
+	deleted, failed, err := deleteResources(context.Background(), req, resources, Options{BackupDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != len(resources) || len(failed) != 0 {
+		t.Fatalf("deleted %d, failed %d, want %d, 0", len(deleted), len(failed), len(resources))
+	}
+
+	for id, item := range resources {
+		if got := strings.Join(events[id], ","); got != "backup,delete" {
+			t.Errorf("%s: events %q, want backup before delete", id, got)
+		}
+
+		b, err := os.ReadFile(backupPath(dir, item))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(b) != "content of "+id {
+			t.Errorf("%s: backup content %q", id, b)
+		}
+	}
+}
+
+func TestDeleteResourcesBackupAllFirst(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deletes int
+	)
+
+	const broken = "00000000000000000000000000000003"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/resources/")
+		id, isFile := strings.CutSuffix(path, "/file")
+
+		switch {
+		case r.Method == http.MethodDelete:
+			mu.Lock()
+			deletes++
+			mu.Unlock()
+		case isFile && id == broken:
+			fmt.Fprint(w, "truncated") // 大小和 resource size 不一致
+		case isFile:
+			fmt.Fprint(w, "content of "+id)
+		}
+	}))
+	defer ts.Close()
+
+	req := testReq(ts)
+
+	resources := make(map[string]Item)
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("%032x", i)
+		resources[id] = Item{ID: id, Size: int64(len("content of " + id))}
+	}
+
+	opt := Options{BackupDir: t.TempDir(), BackupAllFirst: true}
+	deleted, failed, err := deleteResources(context.Background(), req, resources, opt)
+	if err == nil {
+		t.Fatal("want error when a backup doesn't match")
+	}
+	if len(deleted) != 0 || deletes != 0 {
+		t.Errorf("deleted %d resources, %d DELETE requests, want none", len(deleted), deletes)
+	}
+	if len(failed) != 1 || failed[0].ID != broken {
+		t.Errorf("failed %+v, want only %s", failed, broken)
+	}
+
+	// 所有备份都正确时才删除.
+	delete(resources, broken)
+	deleted, _, err = deleteResources(context.Background(), req, resources, Options{BackupDir: t.TempDir(), BackupAllFirst: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != len(resources) {
+		t.Errorf("deleted %d, want %d", len(deleted), len(resources))
+	}
+}
+
+func TestDeleteResourcesMaxDownloadSize(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		downloads = make(map[string]bool)
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, isFile := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/resources/"), "/file")
+		if isFile {
+			mu.Lock()
+			downloads[id] = true
+			mu.Unlock()
+			n := 100
+			if id == "small" {
+				n = 40
+			}
+			fmt.Fprint(w, strings.Repeat("x", n))
+		}
+	}))
+	defer ts.Close()
+
+	req := testReq(ts)
+	req.Concurrency = 2
+
+	resources := map[string]Item{
+		"small": {ID: "small", Size: 40},
+		"huge":  {ID: "huge", Size: 1 << 40},
+		"lying": {ID: "lying", Size: 10}, // size metadata 比实际文件小
+	}
+
+	for _, allFirst := range []bool{false, true} {
+		mu.Lock()
+		downloads = make(map[string]bool)
+		mu.Unlock()
+		opt := Options{BackupDir: t.TempDir(), BackupAllFirst: allFirst, MaxDownloadSize: 50, KeepGoing: true}
+		deleted, failed, err := deleteResources(context.Background(), req, resources, opt)
+		if err == nil {
+			t.Errorf("allFirst %v: want error", allFirst)
+		}
+
+		mu.Lock()
+		huge := downloads["huge"]
+		mu.Unlock()
+		if huge {
+			t.Errorf("allFirst %v: huge resource should not be downloaded", allFirst)
+		}
+		for _, r := range deleted {
+			if r.ID != "small" {
+				t.Errorf("allFirst %v: %s is deleted without a backup", allFirst, r.ID)
+			}
+		}
+		if len(failed) != 2 {
+			t.Errorf("allFirst %v: got %d failures, want huge and lying", allFirst, len(failed))
+		}
+		if allFirst && len(deleted) > 0 {
+			t.Errorf("allFirst %v: deleted %d, want nothing deleted after a failed backup", allFirst, len(deleted))
+		}
+	}
+}
+
+// -backup-dir 时, 超过 -max-download-size 的 resources 在 scan 时就被保留.
+func TestDeleteUnusedMaxDownloadSize(t *testing.T) {
+	m, req := newMockJoplin(t, []Item{{ID: "small", Size: 40}, {ID: "huge", Size: 1 << 40}}, nil)
+
+	opt := Options{IncludeLocked: true, Delete: true, BackupDir: t.TempDir(), MaxDownloadSize: 50}
+	report, err := req.DeleteUnused(context.Background(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Deleted) != 1 || report.Deleted[0].ID != "small" {
+		t.Errorf("deleted %v, want only small", report.Deleted)
+	}
+	if dc := report.Decisions["huge"]; !dc.Keep || !strings.Contains(dc.Reason, "-max-download-size") {
+		t.Errorf("huge: %+v, want kept for -max-download-size", dc)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.resources["huge"]; !ok {
+		t.Error("huge is deleted")
+	}
+}
+
+// 下载大文件的时间超过 http client 的 Timeout 也不会失败, 只受 ctx 限制.
+func TestBackupResourceNoClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "first half,")
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, "second half")
+	}))
+	defer ts.Close()
+
+	req := testReq(ts)
+	req.HTTPClient = &http.Client{Timeout: 20 * time.Millisecond, Transport: NewHTTPClient(req.Token).Transport}
+
+	dir := t.TempDir()
+	item := Item{ID: "00000000000000000000000000000001", Size: int64(len("first half,second half"))}
+	if err := backupResource(context.Background(), req, dir, item, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBackup(dir, item); err != nil {
+		t.Fatal(err)
+	}
+
+	// ctx 仍然限制下载.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := backupResource(ctx, req, dir, item, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,276 @@
+// Package cleaner finds and deletes joplin attachments (resources) that no note references.
+// 只通过 Web Clipper service 的 REST API 访问 joplin, 见 Client.
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Options of Client.DeleteUnused().
+type Options struct {
+	IncludeLocked    bool          // also delete resources updated within LockedWindow
+	OlderThan        time.Duration // only delete resources not updated within this duration, 0 means no limit
+	ProtectZero      bool          // keep zero-size resources
+	Strict           bool          // also keep resources linked from note bodies even if the API reports no references
+	Snapshot         bool          // find references from one complete read of all note bodies instead of checking each resource
+	NotebookActivity time.Duration // keep resources linked from notebooks with note activity within this duration, 0 means disabled
+	ProtectPath      string        // keep resources linked from notes under this notebook path, eg: "Work/Clients"
+	Filter           Expr          // only delete resources matching this expression, nil means all unused resources
+	KeepIDs          []string      // never delete these resources
+	OnlyIDs          []string      // only delete these resources, nil means all unused resources
+	NeverDeleteMimes []string      // never delete resources of these MIME types, "type/*" matches all subtypes
+	MaxFree          int64         // refuse to delete if more bytes would be freed, unless Force. 0 means no limit
+	Force            bool          // ignore MaxFree
+
+	Delete    bool               // false means scan only
+	Confirm   func(*Report) bool // called before deleting, returns false to cancel. nil means no confirmation
+	Rescan    bool               // scan again after Confirm, only delete resources unused in both scans
+	Reverify  bool               // check references again right before deleting each resource
+	KeepGoing bool               // continue deleting after an error
+	Order     string             // OrderID | OrderSizeDesc, "" means OrderID
+	BackupDir string             // download resources to this dir before deleting
+	Dangling  bool               // after deleting, find notes whose bodies still link to the deleted resources
+
+	// back up and verify all resources in BackupDir before deleting any, a failed backup deletes nothing.
+	BackupAllFirst bool
+	// with BackupDir, keep resources larger than this many bytes, they can't be backed up.
+	// 0 means no limit
+	MaxDownloadSize int64
+
+	// called periodically during each phase, nil means no progress report.
+	// 可能在不同的 goroutine 中被调用, 但不会并发调用.
+	Progress func(Progress)
+
+	Timeout       time.Duration // deadline of the whole run, 0 means no deadline
+	ListTimeout   time.Duration // deadline of the listing phase, 0 means inherit Timeout
+	FilterTimeout time.Duration // deadline of the filtering phase, 0 means inherit Timeout
+	DeleteTimeout time.Duration // deadline of the deleting phase, 0 means inherit Timeout
+}
+
+// result of Client.DeleteUnused().
+type Report struct {
+	Summary   Summary
+	Unused    map[string]Item // unused resources after all filters, nil means scanning failed
+	Decisions Decisions       // why each scanned resource is kept or deleted
+	Confirmed bool            // deletion has been confirmed, see Options.Confirm
+	Deleted   []DeleteRecord
+	Failures  []DeleteFailure
+	Dangling  []DanglingNote // notes linking to deleted resources, see Options.Dangling
+}
+
+// 每个 phase 可以单独设置 timeout, 没有设置时继承 ctx 的 deadline.
+func phaseContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// 记录 error 发生在哪个 phase: list | filter | delete, 见 -format json 的 error object.
+type PhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (e *PhaseError) Error() string { return e.Err.Error() }
+func (e *PhaseError) Unwrap() error { return e.Err }
+
+// DeleteUnused lists all resources, filters out the used ones, and deletes the rest if opts.Delete is set.
+// 不会读写 stdin / stdout, 和用户的交互通过 opts.Confirm 完成.
+// 出错时返回的 Report 中包含出错之前的结果.
+func (req Client) DeleteUnused(ctx context.Context, opts Options) (report Report, err error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	if err = req.scan(ctx, opts, &report); err != nil {
+		return report, err
+	}
+	resources := report.Unused
+
+	if !opts.Delete || len(resources) < 1 {
+		return report, nil
+	}
+
+	// 要释放的空间过大可能是误操作, 需要 Force.
+	if opts.MaxFree > 0 {
+		var total int64
+		for _, item := range resources {
+			total += item.Size
+		}
+		if total > opts.MaxFree && !opts.Force {
+			err := fmt.Errorf("deleting would free %s (%d bytes), exceeds -max-free-bytes %d, use -force to delete anyway", FormatBytes(total), total, opts.MaxFree)
+			return report, &PhaseError{Phase: "delete", Err: err}
+		}
+	}
+
+	if opts.Confirm != nil && !opts.Confirm(&report) {
+		return report, nil
+	}
+	report.Confirmed = true
+
+	if opts.Rescan {
+		if err = req.rescan(ctx, opts, &report); err != nil {
+			return report, err
+		}
+	}
+
+	start := time.Now()
+	deleteCtx, cancel := phaseContext(ctx, opts.DeleteTimeout)
+	report.Deleted, report.Failures, err = deleteResources(deleteCtx, req, resources, opts)
+	cancel()
+	report.Summary.Phases.Delete = time.Since(start)
+	if err != nil {
+		err = &PhaseError{Phase: "delete", Err: err}
+	}
+
+	// 只是报告, 失败不影响删除的结果.
+	if opts.Dangling && len(report.Deleted) > 0 {
+		if dangling, derr := danglingNotes(ctx, req, report.Deleted); derr == nil {
+			report.Dangling = dangling
+		}
+	}
+
+	report.Summary.Deleted = len(report.Deleted)
+	report.Summary.Failed = len(report.Failures)
+	for _, r := range report.Deleted {
+		report.Summary.Freed += r.Size
+	}
+
+	return report, err
+}
+
+// listing 和 filtering phases, 结果记录在 r 中.
+func (req Client) scan(ctx context.Context, opts Options, r *Report) error {
+	start := time.Now()
+	listCtx, cancel := phaseContext(ctx, opts.ListTimeout)
+	resources, err := getAllResources(listCtx, req)
+	cancel()
+	r.Summary.Phases.List = time.Since(start)
+	if err != nil {
+		return &PhaseError{Phase: "list", Err: err}
+	}
+	r.Summary.Scanned = len(resources)
+
+	// listing 结束之前不知道 total, 所以只报告结果.
+	p := newProgressReporter(opts.Progress, "list", len(resources))
+	p.add(len(resources))
+	p.done()
+
+	// filtering phase 包括 reference check 和所有 filters.
+	start = time.Now()
+	d := make(Decisions)
+	filterCtx, cancel := phaseContext(ctx, opts.FilterTimeout)
+	check := filterResourcesNotify
+	if opts.Snapshot {
+		check = snapshotReferences
+	}
+	err = d.step("references", resources, func() error {
+		return scanResources(filterCtx, req, resources, d, check, opts.Progress)
+	})
+	if err == nil && opts.Strict {
+		err = d.step("only-delete-zero-reference", resources, func() error {
+			return skipBodyLinkedResources(filterCtx, req, resources, d)
+		})
+	}
+	if err == nil && opts.NotebookActivity > 0 {
+		err = d.step("exclude-recent-notebook-activity", resources, func() error {
+			return skipActiveNotebookResources(filterCtx, req, resources, d, time.Now().Add(-opts.NotebookActivity))
+		})
+	}
+	if err == nil && opts.ProtectPath != "" {
+		err = d.step("protect-path", resources, func() error {
+			return skipProtectedPathResources(filterCtx, req, resources, d, opts.ProtectPath)
+		})
+	}
+	cancel()
+	if err != nil {
+		return &PhaseError{Phase: "filter", Err: err}
+	}
+
+	// 以下 filters 不会出错, 只使用 metadata.
+	filter := func(name string, f func()) {
+		_ = d.step(name, resources, func() error { f(); return nil })
+	}
+
+	if !opts.IncludeLocked {
+		filter("locked", func() { skipLockedResources(resources, d, time.Now()) })
+	}
+
+	if opts.OlderThan > 0 {
+		filter("older-than", func() { skipNewerResources(resources, d, time.Now().Add(-opts.OlderThan)) })
+	}
+
+	if opts.ProtectZero {
+		filter("protect-zero-size", func() { skipZeroSizeResources(resources, d) })
+	}
+
+	if len(opts.KeepIDs) > 0 {
+		filter("keep-file", func() { skipKeptIDs(resources, d, opts.KeepIDs) })
+	}
+
+	if opts.OnlyIDs != nil {
+		filter("only-ids", func() { skipUnlistedIDs(resources, d, opts.OnlyIDs) })
+	}
+
+	if opts.Filter != nil {
+		err = d.step("filter-expr", resources, func() error {
+			return applyFilterExpr(resources, d, opts.Filter)
+		})
+		if err != nil {
+			return &PhaseError{Phase: "filter", Err: err}
+		}
+	}
+
+	// 没有备份不能删除.
+	if opts.BackupDir != "" && opts.MaxDownloadSize > 0 {
+		filter("max-download-size", func() { skipTooLargeToBackUp(resources, d, opts.MaxDownloadSize) })
+	}
+
+	// 最后执行, 保证不受其他 options 的影响.
+	if len(opts.NeverDeleteMimes) > 0 {
+		filter("never-delete-mime", func() { skipProtectedMimes(resources, d, opts.NeverDeleteMimes) })
+	}
+	d.MarkDeletes(resources)
+	r.Summary.Phases.Filter = time.Since(start)
+
+	r.Unused = resources
+	r.Decisions = d
+	r.Summary.Unused = len(resources)
+	return nil
+}
+
+// confirm 之后重新扫描, 只删除两次扫描都认为 unused 的 resources,
+// 避免删除在等待 confirm 期间被重新引用或者被修改的 resources.
+func (req Client) rescan(ctx context.Context, opts Options, r *Report) error {
+	var fresh Report
+	if err := req.scan(ctx, opts, &fresh); err != nil {
+		return err
+	}
+
+	_ = r.Decisions.step("safe-delete", r.Unused, func() error {
+		for _, id := range SortedIDs(r.Unused) {
+			if _, ok := fresh.Unused[id]; ok {
+				continue
+			}
+
+			reason := "changed since confirmation"
+			if dc, ok := fresh.Decisions[id]; ok {
+				reason += ", " + dc.Reason
+			} else {
+				reason += ", no longer exists"
+			}
+			req.logger().Printf("skip %s: %s\n", id, reason)
+			r.Decisions.Keep(r.Unused, id, reason)
+		}
+		return nil
+	})
+	r.Summary.Unused = len(r.Unused)
+	r.Summary.Phases.List += fresh.Summary.Phases.List
+	r.Summary.Phases.Filter += fresh.Summary.Phases.Filter
+	return nil
+}
@@ -0,0 +1,165 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeleteUnused(t *testing.T) {
+	var all []Item
+	refs := make(map[string][]string)
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("%032x", i)
+		all = append(all, Item{ID: id, Size: 100})
+		if i%2 == 0 {
+			refs[id] = []string{"note"}
+		}
+	}
+	m, req := newMockJoplin(t, all, refs)
+
+	// Confirm 返回 false 时不删除.
+	report, err := req.DeleteUnused(context.Background(), Options{
+		IncludeLocked: true,
+		Delete:        true,
+		Confirm:       func(*Report) bool { return false },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Confirmed || len(report.Deleted) != 0 || len(m.resources) != len(all) {
+		t.Fatalf("deleted without confirmation: %+v", report.Summary)
+	}
+
+	report, err = req.DeleteUnused(context.Background(), Options{
+		IncludeLocked: true,
+		Delete:        true,
+		Confirm: func(r *Report) bool {
+			if len(r.Unused) != 5 {
+				t.Errorf("confirm got %d unused, want 5", len(r.Unused))
+			}
+			return true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Summary{Scanned: 10, Unused: 5, Deleted: 5, Freed: 500}
+	if report.Summary.Phases.List <= 0 || report.Summary.Phases.Filter <= 0 || report.Summary.Phases.Delete <= 0 {
+		t.Errorf("phase timings not recorded: %+v", report.Summary.Phases)
+	}
+	report.Summary.Phases = PhaseTimes{}
+	if report.Summary != want {
+		t.Errorf("summary %+v, want %+v", report.Summary, want)
+	}
+	for id := range refs {
+		if _, ok := m.resources[id]; !ok {
+			t.Errorf("%s is used, should not be deleted", id)
+		}
+	}
+	if len(m.resources) != len(refs) {
+		t.Errorf("%d resources left, want %d", len(m.resources), len(refs))
+	}
+}
+
+func TestDeleteUnusedRescan(t *testing.T) {
+	var all []Item
+	for i := 0; i < 4; i++ {
+		all = append(all, Item{ID: fmt.Sprintf("%032x", i)})
+	}
+	m, req := newMockJoplin(t, all, make(map[string][]string))
+	referenced := all[1].ID
+
+	report, err := req.DeleteUnused(context.Background(), Options{
+		IncludeLocked: true,
+		Delete:        true,
+		Rescan:        true,
+		Confirm: func(r *Report) bool {
+			// 等待 confirm 期间被重新引用.
+			m.mu.Lock()
+			m.refs[referenced] = []string{"note"}
+			m.mu.Unlock()
+			return true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Deleted) != 3 {
+		t.Errorf("deleted %d, want 3", len(report.Deleted))
+	}
+	if _, ok := m.resources[referenced]; !ok || !report.Decisions[referenced].Keep {
+		t.Errorf("%s is referenced after confirmation, should not be deleted", referenced)
+	}
+}
+
+func TestDeleteUnusedErrorPhase(t *testing.T) {
+	_, req := newMockJoplin(t, []Item{{ID: "a"}}, nil)
+	req.Token = "wrong"
+
+	_, err := req.DeleteUnused(context.Background(), Options{})
+	if err == nil {
+		t.Fatal("want error with a wrong token")
+	}
+
+	var pe *PhaseError
+	if !errors.As(err, &pe) || pe.Phase != "list" {
+		t.Errorf("got %v, want error in phase list", err)
+	}
+	var ae *APIError
+	if !errors.As(err, &ae) || ae.Status != http.StatusForbidden {
+		t.Errorf("got %v, want APIError with status 403", err)
+	}
+}
+
+func TestDeleteUnusedSnapshot(t *testing.T) {
+	var all []Item
+	for i := 0; i < 4; i++ {
+		all = append(all, Item{ID: fmt.Sprintf("%032x", i), Title: fmt.Sprint(i)})
+	}
+	// refs 为空, 只有 note body 中的链接算引用.
+	m, req := newMockJoplin(t, all, nil)
+	m.notes = []Item{{ID: "n1", Body: "![](:/" + all[0].ID + ") [a.pdf](:/" + all[2].ID + ")"}}
+
+	report, err := req.DeleteUnused(context.Background(), Options{IncludeLocked: true, Snapshot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(SortedIDs(report.Unused), ","); got != all[1].ID+","+all[3].ID {
+		t.Errorf("unused %s, want %s and %s", got, all[1].ID, all[3].ID)
+	}
+	if report.Unused[all[1].ID].Title != "1" {
+		t.Errorf("unused resources should have metadata, got %+v", report.Unused[all[1].ID])
+	}
+	if !report.Decisions[all[0].ID].Keep || report.Decisions[all[0].ID].Notes != 1 {
+		t.Errorf("%s: got %+v, want kept by 1 note", all[0].ID, report.Decisions[all[0].ID])
+	}
+}
+
+func TestDeleteUnusedDangling(t *testing.T) {
+	all := []Item{{ID: fmt.Sprintf("%032x", 0)}, {ID: fmt.Sprintf("%032x", 1)}}
+	// API 没有报告引用, 但是 n1 的 body 中有链接.
+	m, req := newMockJoplin(t, all, nil)
+	m.notes = []Item{
+		{ID: "n1", Title: "stale", Body: "![](:/" + all[0].ID + ") ![](:/" + all[0].ID + ")"},
+		{ID: "n2", Title: "clean", Body: "no links"},
+	}
+
+	report, err := req.DeleteUnused(context.Background(), Options{IncludeLocked: true, Delete: true, Dangling: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Dangling) != 1 {
+		t.Fatalf("got %+v, want only n1", report.Dangling)
+	}
+	if d := report.Dangling[0]; d.ID != "n1" || strings.Join(d.ResourceIDs, ",") != all[0].ID {
+		t.Errorf("got %+v, want n1 linking %s once", d, all[0].ID)
+	}
+}
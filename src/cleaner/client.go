@@ -0,0 +1,612 @@
+// DOC:
+// https://joplinapp.org/api/references/rest_api/
+// https://joplinapp.org/api/references/rest_api/#resources
+
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// joplin API 返回的 resource, note 或 notebook, 只包含用到的 fields.
+type Item struct {
+	ID              string `json:"id"`                          // resource ID / note ID
+	Title           string `json:"title,omitempty"`             // resource title / note title
+	Mime            string `json:"mime,omitempty"`              // resource mime type, notes 没有这个字段
+	Size            int64  `json:"size,omitempty"`              // resource size in bytes, notes 没有这个字段
+	BlobUpdatedTime int64  `json:"blob_updated_time,omitempty"` // resource 文件最后修改时间, unix ms
+	IsConflict      int    `json:"is_conflict,omitempty"`       // note 是否是 conflict note, 0 / 1
+	FileExtension   string `json:"file_extension,omitempty"`    // resource 文件扩展名, 不包含 "."
+	CreatedTime     int64  `json:"created_time,omitempty"`      // unix ms
+	UpdatedTime     int64  `json:"updated_time,omitempty"`      // unix ms
+	ParentID        string `json:"parent_id,omitempty"`         // note 或 sub-notebook 所在的 notebook ID
+	Body            string `json:"body,omitempty"`              // note body, markdown
+	DeletedTime     int64  `json:"deleted_time,omitempty"`      // note 移到回收站的时间, unix ms, 0 表示不在回收站
+}
+
+// response need to be parsed
+type joplinResponse struct {
+	Error string `json:"error"`
+	Items []Item `json:"items"`
+	More  bool   `json:"has_more"`
+
+	// 目前的 joplin 不返回 total, 兼容返回 total 或 count 的 server, 见 Client.PageByTotal.
+	Total *int `json:"total,omitempty"`
+	Count *int `json:"count,omitempty"`
+}
+
+// total number of items in all pages, false 表示 server 没有返回.
+func (r joplinResponse) total() (int, bool) {
+	switch {
+	case r.Total != nil:
+		return *r.Total, true
+	case r.Count != nil:
+		return *r.Count, true
+	}
+	return 0, false
+}
+
+// 访问 joplin Web Clipper service 的 client. 至少需要设置 Port 和 Token, 其余 fields 的 zero value 都可以使用.
+type Client struct {
+	Port        int          // joplin Web Clipper service port
+	Token       string       // joplin token
+	Concurrency int          // max concurrent requests, <= 1 means sequential
+	Server      Server       // differences between joplin versions, see Client.Probe()
+	HTTPClient  *http.Client // nil means NewHTTPClient(Token), see Client.httpClient()
+	MaxPages    int          // max pages to fetch in getAllResources(), 0 means unlimited
+
+	// 返回的 page 不满 pageLimit 但 has_more 为 true 时停止, 认为已经是最后一页.
+	// 默认 (false) 相信 server 的 has_more, 继续请求下一页, 见 getAllResources().
+	StopOnPartialPage bool
+
+	ListStateFile string // 保存 getAllResources() 的进度, "" 表示不保存
+	MetaCacheDir  string // 缓存 resource metadata 的目录, "" 表示不缓存, 见 metaCache
+
+	// 第一页返回了 total 时, 根据 total 计算页数并发请求其余的 pages, 否则依然使用 has_more.
+	// 和 ListStateFile 一起使用时不生效, 因为 state 需要按顺序保存每一页.
+	PageByTotal bool
+
+	// warnings 和进度信息, 例如跳过的 resources. 返回的 errors 不会再写入 Logger.
+	// nil 表示不输出, CLI 使用 log.Default().
+	Logger *log.Logger
+}
+
+var discardLogger = log.New(io.Discard, "", 0)
+
+func (req Client) logger() *log.Logger {
+	if req.Logger == nil {
+		return discardLogger
+	}
+	return req.Logger
+}
+
+// joplin server 返回 4xx / 5xx.
+type APIError struct {
+	Method   string
+	Endpoint string // url path, 不包含 query, 所以不会包含 token
+	Status   int
+	Message  string // joplin 返回的 error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Endpoint, e.Status, e.Message)
+}
+
+// joplin 出错时返回 error status 以及 {"error": "..."}
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	var e joplinResponse
+	_ = json.NewDecoder(resp.Body).Decode(&e)
+	if e.Error == "" {
+		e.Error = http.StatusText(resp.StatusCode)
+	}
+	return &APIError{Method: resp.Request.Method, Endpoint: resp.Request.URL.Path, Status: resp.StatusCode, Message: e.Error}
+}
+
+func readRespBody(ctx context.Context, req Client, method, url string, v any) error {
+	r, err := http.NewRequestWithContext(ctx, method, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	resp, err := req.httpClient().Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = checkResponse(resp); err != nil {
+		return err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	// resp.Body 为空的时候, Unmarshal() 会报 EOF. Delete resources 成功之后 resp.Body 为空.
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+// pagination 每页的数量, joplin 限制最大为 100.
+const pageLimit = 100
+
+// DOC: Gets all resources.
+// https://joplinapp.org/api/references/rest_api/#get-resources
+// https://joplinapp.org/api/references/rest_api/#pagination
+// returns attachments, key is resource ID.
+// 设置了 req.ListStateFile 时, 每完成一页保存一次进度, 中断之后从下一页继续, 完成之后删除.
+// 设置了 req.PageByTotal 并且 server 返回了 total 时, 见 getPagesByTotal().
+func getAllResources(ctx context.Context, req Client) (resources map[string]Item, err error) {
+	resources = make(map[string]Item)
+
+	var state listState
+	if req.ListStateFile != "" {
+		state, err = loadListState(req.ListStateFile, req.Port, req.logger())
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range state.IDs {
+			resources[id] = Item{ID: id}
+		}
+	}
+
+	var mark = true
+	for page := state.Page + 1; mark; page++ {
+		resp, err := getResourcesPage(ctx, req, page)
+		if err != nil {
+			return nil, err
+		}
+
+		if page == 1 && req.PageByTotal && req.ListStateFile == "" {
+			if total, ok := resp.total(); ok {
+				rest, err := getPagesByTotal(ctx, req, total)
+				if err != nil {
+					return nil, err
+				}
+				for _, item := range append(resp.Items, rest...) {
+					resources[item.ID] = item
+				}
+				break
+			}
+			req.logger().Println("warning: server doesn't report the total number of resources, paging by has_more")
+		}
+
+		for _, item := range resp.Items {
+			resources[item.ID] = item
+		}
+
+		// 判断后续是否有更多的 resources.
+		mark = resp.More
+
+		if req.ListStateFile != "" {
+			state.Port, state.Page = req.Port, page
+			ids := make([]string, 0, len(resp.Items))
+			for _, item := range resp.Items {
+				ids = append(ids, item.ID)
+			}
+			if err := saveListPage(req.ListStateFile, state, ids); err != nil {
+				return nil, err
+			}
+		}
+
+		// 正常情况下只有最后一页不满 pageLimit. 空页之后继续请求不会有进展, 总是停止;
+		// 其他不满的页默认相信 has_more, 最坏的情况是多请求几页.
+		if mark && len(resp.Items) < pageLimit {
+			if len(resp.Items) == 0 || req.StopOnPartialPage {
+				req.logger().Printf("warning: page %d has %d resources but has_more is true, assuming it is the last page\n", page, len(resp.Items))
+				break
+			}
+			req.logger().Printf("warning: page %d has %d resources but has_more is true, fetching next page\n", page, len(resp.Items))
+		}
+
+		// 超过 maxPages 说明 pagination 可能有问题, 报错而不是静默停止.
+		if mark && req.MaxPages > 0 && page >= req.MaxPages {
+			err := fmt.Errorf("fetched %d pages, server still has more resources, exceeds -max-pages %d", page, req.MaxPages)
+			return nil, err
+		}
+	}
+
+	if req.ListStateFile != "" {
+		if err := removeListState(req.ListStateFile); err != nil {
+			req.logger().Println(err)
+		}
+	}
+
+	if len(resources) == 0 {
+		checkEmptyListing(ctx, req)
+	}
+
+	return resources, nil
+}
+
+// 获取第 page 页的 resources, 见 getAllResources().
+func getResourcesPage(ctx context.Context, req Client, page int) (resp joplinResponse, err error) {
+	// GET request:
+	// - limit: max restricted to 100.
+	// - sort: by id.
+	// - page: start from 1.
+	// - fields: columns, 只需要 id 和 updated_time (用于 metaCache), 其他 metadata 在 scanResources() 中获取.
+	url := fmt.Sprintf("http://localhost:%d/resources?fields=id,updated_time&order_by=id&limit=%d&page=%d", req.Port, pageLimit, page)
+	err = readRespBody(ctx, req, "GET", url, &resp)
+	if err != nil {
+		return resp, err
+	}
+
+	// joplin server return error.
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+
+	return resp, nil
+}
+
+// 根据 total 计算页数, 用 req.Concurrency 个 goroutines 并发请求第 2 页之后的所有 pages.
+// 只请求计算出的页数, 不检查 has_more; 请求期间新增的 resources 可能被漏掉, 漏掉的只是不会被删除.
+func getPagesByTotal(ctx context.Context, req Client, total int) ([]Item, error) {
+	pages := (total + pageLimit - 1) / pageLimit
+	if req.MaxPages > 0 && pages > req.MaxPages {
+		err := fmt.Errorf("server reports %d resources in %d pages, exceeds -max-pages %d", total, pages, req.MaxPages)
+		return nil, err
+	}
+	if pages < 2 {
+		return nil, nil
+	}
+
+	// 第一个 error 之后 cancel, 不再请求剩下的 pages, 正在进行的 requests 也会中止.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		results  = make([][]Item, pages+1) // index by page
+		pageCh   = make(chan int)
+	)
+	for i := 0; i < max(req.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pageCh {
+				resp, err := getResourcesPage(ctx, req, page)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				results[page] = resp.Items
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for page := 2; page <= pages; page++ {
+		select {
+		case pageCh <- page:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(pageCh)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	var items []Item
+	for _, r := range results {
+		items = append(items, r...)
+	}
+	req.logger().Printf("listed %d pages by total %d\n", pages, total)
+	return items, nil
+}
+
+// 空的 library 和 server 静默失败 (没有 error, 也没有 items) 的返回是一样的,
+// 通过 note body 中是否有 resource 链接来区分. 只打印 warning, 不影响结果.
+func checkEmptyListing(ctx context.Context, req Client) {
+	links, err := bodyLinks(ctx, req)
+	if err != nil {
+		req.logger().Println("warning: /resources returned no resources, can't check notes to confirm the library is empty")
+		return
+	}
+
+	if len(links) > 0 {
+		req.logger().Printf("warning: /resources returned no resources, but notes link to %d resources, the listing may have failed silently\n", len(links))
+	}
+}
+
+// DOC: Gets the notes (IDs) associated with a resource.
+// https://joplinapp.org/api/references/rest_api/#get-resources-id-notes
+// 使用 req.Concurrency 个 goroutine 并发查询, 将被 note 引用的 resources 从 map 中删除.
+func filterResources(ctx context.Context, req Client, resources map[string]Item) error {
+	return filterResourcesNotify(ctx, req, resources, nil)
+}
+
+// 同 filterResources(), 每查询完一个 resource 就调用一次 onChecked (if not nil), notes 是引用该 resource 的 notes 数量.
+// onChecked 会在多个 goroutine 中被调用.
+func filterResourcesNotify(ctx context.Context, req Client, resources map[string]Item, onChecked func(id string, notes int)) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		used     []string
+		gone     []string
+	)
+
+	ids := make(chan string)
+	for i := 0; i < max(req.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				notes, err := countResourceNotes(ctx, req, id)
+
+				// resource 在扫描过程中被删除了, 不算错误.
+				if errors.Is(err, errResourceGone) {
+					req.logger().Printf("skip %s: resource not found, deleted during scanning\n", id)
+					mu.Lock()
+					gone = append(gone, id)
+					mu.Unlock()
+					continue
+				}
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if notes > 0 {
+					used = append(used, id)
+				}
+				mu.Unlock()
+
+				if err == nil && onChecked != nil {
+					onChecked(id, notes)
+				}
+			}
+		}()
+	}
+
+	for id := range resources {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	// 从 map 中删除
+	for _, id := range used {
+		delete(resources, id)
+	}
+	for _, id := range gone {
+		delete(resources, id)
+	}
+
+	return nil
+}
+
+// GET /resources/:id 或 /resources/:id/notes 返回 404, resource 已经不存在了.
+var errResourceGone = errors.New("resource not found")
+
+// 查询引用该 resource 的 notes 数量.
+func countResourceNotes(ctx context.Context, req Client, id string) (int, error) {
+	notes, err := getResourceNotes(ctx, req, id, "id")
+	return len(notes), err
+}
+
+// DOC: Gets the notes (IDs) associated with a resource.
+// https://joplinapp.org/api/references/rest_api/#get-resources-id-notes
+// https://joplinapp.org/api/references/rest_api/#pagination
+// resource 不存在时返回 errResourceGone.
+func getResourceNotes(ctx context.Context, req Client, id, fields string) (notes []Item, err error) {
+	var mark = true
+	for page := 1; mark; page++ {
+		url := fmt.Sprintf("http://localhost:%d/resources/%s/notes?fields=%s&order_by=id&limit=%d&page=%d", req.Port, id, fields, pageLimit, page)
+
+		var resp joplinResponse
+		err = readRespBody(ctx, req, "GET", url, &resp)
+		var ae *APIError
+		if errors.As(err, &ae) && ae.Status == http.StatusNotFound {
+			return nil, errResourceGone
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// joplin server return error.
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+
+		// 如果 items 不存在, 说明引用该 resources 的 note 不存在.
+		notes = append(notes, resp.Items...)
+		mark = resp.More
+	}
+
+	return notes, nil
+}
+
+// resources 的 IDs, 按 ID 排序, 用于稳定的输出顺序.
+func SortedIDs(resources map[string]Item) []string {
+	ids := make([]string, 0, len(resources))
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// 删除顺序, 见 -delete-order.
+const (
+	OrderID       = "id"        // 按 ID 排序
+	OrderSizeDesc = "size-desc" // 先删除最大的, 中断时已释放的空间最多
+)
+
+// 按 order 排序 resources, size 相同时按 ID 排序.
+func deleteOrder(resources map[string]Item, order string) []Item {
+	items := make([]Item, 0, len(resources))
+	for _, id := range SortedIDs(resources) {
+		items = append(items, resources[id])
+	}
+
+	if order == OrderSizeDesc {
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].Size > items[j].Size
+		})
+	}
+	return items
+}
+
+// 根据 resources id 删除无用的 resources.
+// Delete "http://localhost:port/resources/:id", token 由 withToken() 添加.
+// 使用 req.Concurrency 个 goroutine 并发删除. 如果设置了 opt.BackupDir, 每个 resource 在删除之前先备份,
+// 备份和删除在同一个 goroutine 中依次执行, 备份失败则不删除该 resource.
+// 设置了 opt.BackupAllFirst 时, 先备份并检查所有 resources, 全部成功之后才开始删除, 见 backupAll().
+// 遇到错误时, opt.KeepGoing 为 false 则不再删除其他 resources, 否则继续删除.
+// returns resources which have been deleted, failures, and the first error.
+func deleteResources(ctx context.Context, req Client, resources map[string]Item, opt Options) (deleted []DeleteRecord, failed []DeleteFailure, err error) {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	if opt.BackupAllFirst && opt.BackupDir != "" {
+		if failed, err = backupAll(ctx, req, opt.BackupDir, resources, opt.MaxDownloadSize); err != nil {
+			return nil, failed, err
+		}
+		opt.BackupDir = "" // 已经全部备份
+	}
+
+	p := newProgressReporter(opt.Progress, "delete", len(resources))
+	defer p.done()
+
+	items := make(chan Item)
+	for i := 0; i < max(req.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				record, f, skipped := deleteResource(ctx, req, item, opt)
+				p.add(1)
+				if skipped {
+					continue
+				}
+
+				mu.Lock()
+				if f != nil {
+					failed = append(failed, *f)
+					if err == nil {
+						err = errors.New(f.Error)
+					}
+				} else {
+					deleted = append(deleted, record)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// 按 opt.Order 依次交给 workers, 并发时完成的顺序可能略有不同.
+	for _, item := range deleteOrder(resources, opt.Order) {
+		mu.Lock()
+		stop := err != nil && !opt.KeepGoing
+		mu.Unlock()
+		if stop {
+			break
+		}
+
+		// timeout 之后不再删除其他 resources.
+		if ctx.Err() != nil {
+			mu.Lock()
+			if err == nil {
+				err = ctx.Err()
+			}
+			mu.Unlock()
+			break
+		}
+		items <- item
+	}
+	close(items)
+	wg.Wait()
+
+	return deleted, failed, err
+}
+
+// 检查 (optional), 备份 (optional) 并删除一个 resource.
+// skipped 为 true 表示 reverify 时发现 resource 又被引用了, 没有删除.
+func deleteResource(ctx context.Context, req Client, item Item, opt Options) (_ DeleteRecord, _ *DeleteFailure, skipped bool) {
+	if opt.Reverify {
+		notes, err := countResourceNotes(ctx, req, item.ID)
+		if errors.Is(err, errResourceGone) {
+			req.logger().Printf("skip %s: resource not found, already deleted\n", item.ID)
+			return DeleteRecord{}, nil, true
+		}
+		if err != nil {
+			f := newDeleteFailure(item.ID, "GET /resources/"+item.ID+"/notes", err)
+			return DeleteRecord{}, &f, false
+		}
+		if notes > 0 {
+			req.logger().Printf("skip %s: referenced by notes since scanning\n", item.ID)
+			return DeleteRecord{}, nil, true
+		}
+	}
+
+	if opt.BackupDir != "" {
+		err := errTooLargeToDownload(item, opt.MaxDownloadSize)
+		if err == nil {
+			err = backupResource(ctx, req, opt.BackupDir, item, opt.MaxDownloadSize)
+		}
+		if err != nil {
+			f := newDeleteFailure(item.ID, "GET /resources/"+item.ID+"/file", err)
+			return DeleteRecord{}, &f, false
+		}
+	}
+
+	url := fmt.Sprintf("http://localhost:%d/resources/%s", req.Port, item.ID)
+
+	var resp joplinResponse
+	err := readRespBody(ctx, req, "DELETE", url, &resp)
+	if err == nil && resp.Error != "" {
+		err = errors.New(resp.Error)
+	}
+
+	if err != nil {
+		// add to "failToDelete" slice.
+		f := newDeleteFailure(item.ID, "DELETE /resources/"+item.ID, err)
+		return DeleteRecord{}, &f, false
+	}
+
+	return DeleteRecord{
+		ID:          item.ID,
+		Title:       item.Title,
+		Size:        item.Size,
+		Mime:        item.Mime,
+		CreatedTime: item.CreatedTime,
+		UpdatedTime: item.UpdatedTime,
+		DeletedAt:   time.Now(),
+	}, nil, false
+}
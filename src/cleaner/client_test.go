@@ -0,0 +1,231 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetAllRes(t *testing.T) {
+	req := Client{
+		Port:  41184,
+		Token: "2288804904e251f046bb730df0fe60a8cf5ed0f30e0260f00da3feb032aa4fbbe7bc2a57261af926d0ef959b2a2a7b9fe4f2972f95ae4b7320ba7f0d7ca93aec",
+	}
+	resources, err := getAllResources(context.Background(), req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = filterResources(context.Background(), req, resources)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(resources) < 1 {
+		fmt.Println("no unused attachments")
+		return
+	}
+
+	fmt.Println("unused attachments:")
+	for id := range resources {
+		fmt.Println("  - " + id)
+	}
+	fmt.Println("view these attachments in 'Tools > Note attachments'")
+}
+
+func TestFilterResourcesGone(t *testing.T) {
+	m, req := newMockJoplin(t, []Item{{ID: "a"}, {ID: "b"}, {ID: "c"}}, map[string][]string{"b": {"note"}})
+
+	resources, err := getAllResources(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "c" 在 listing 之后被删除, notes lookup 返回 404.
+	m.mu.Lock()
+	delete(m.resources, "c")
+	m.mu.Unlock()
+
+	err = filterResources(context.Background(), req, resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 1 {
+		t.Fatalf("got %v, want only a", SortedIDs(resources))
+	}
+	if _, ok := resources["a"]; !ok {
+		t.Fatalf("got %v, want only a", SortedIDs(resources))
+	}
+}
+
+// 引用超过一页 notes 的 resource, 所有 notes 都要获取到.
+func TestGetResourceNotesPages(t *testing.T) {
+	var notes []string
+	for i := 0; i < pageLimit*2+1; i++ {
+		notes = append(notes, fmt.Sprintf("note%03d", i))
+	}
+	_, req := newMockJoplin(t, []Item{{ID: "a"}}, map[string][]string{"a": notes})
+
+	got, err := getResourceNotes(context.Background(), req, "a", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(notes) {
+		t.Fatalf("got %d notes, want %d", len(got), len(notes))
+	}
+}
+
+func TestDeleteOrder(t *testing.T) {
+	resources := map[string]Item{
+		"a": {ID: "a", Size: 10},
+		"b": {ID: "b", Size: 30},
+		"c": {ID: "c", Size: 10},
+		"d": {ID: "d", Size: 20},
+	}
+
+	for order, want := range map[string]string{
+		OrderID:       "abcd",
+		OrderSizeDesc: "bdac",
+	} {
+		var got string
+		for _, item := range deleteOrder(resources, order) {
+			got += item.ID
+		}
+		if got != want {
+			t.Errorf("%s: got %s, want %s", order, got, want)
+		}
+	}
+}
+
+func TestGetAllResourcesPartialPages(t *testing.T) {
+	// 每页 50 个, 前两页都返回 has_more, 第三页为空.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		var resp joplinResponse
+		if page <= 2 {
+			for i := 0; i < 50; i++ {
+				resp.Items = append(resp.Items, Item{ID: fmt.Sprintf("%032x", page*100+i)})
+			}
+		}
+		resp.More = page <= 3
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	req := testReq(ts)
+
+	for _, tc := range []struct {
+		stop bool
+		want int
+	}{
+		{stop: false, want: 100}, // 相信 has_more, 在空页停止
+		{stop: true, want: 50},
+	} {
+		resources, err := getAllResources(context.Background(), Client{Port: req.Port, StopOnPartialPage: tc.stop})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resources) != tc.want {
+			t.Errorf("stopOnPartialPage %v: got %d resources, want %d", tc.stop, len(resources), tc.want)
+		}
+	}
+}
+
+func TestGetAllResourcesEmpty(t *testing.T) {
+	m, req := newMockJoplin(t, nil, nil)
+	m.notes = []Item{{ID: "n1", Body: "![](:/0123456789abcdef0123456789abcdef)"}}
+
+	// nil Logger 不输出任何内容, 也不会写入全局的 log.
+	var global, buf strings.Builder
+	log.SetOutput(&global)
+	defer log.SetOutput(os.Stderr)
+
+	for _, logger := range []*log.Logger{nil, log.New(&buf, "", 0)} {
+		req.Logger = logger
+		resources, err := getAllResources(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resources) != 0 {
+			t.Fatalf("got %d resources", len(resources))
+		}
+	}
+	if !strings.Contains(buf.String(), "may have failed silently") {
+		t.Errorf("missing warning, log: %q", buf.String())
+	}
+	if global.Len() != 0 {
+		t.Errorf("written to the global log: %q", global.String())
+	}
+}
+
+func TestGetAllResourcesByTotal(t *testing.T) {
+	const total = 250
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		resp := joplinResponse{Total: new(int)}
+		*resp.Total = total
+		for i := (page - 1) * pageLimit; i < min(page*pageLimit, total); i++ {
+			resp.Items = append(resp.Items, Item{ID: fmt.Sprintf("%032x", i)})
+		}
+		// has_more 总是 true, 只有按 total 分页才能停止.
+		resp.More = true
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	req := testReq(ts)
+	req.PageByTotal = true
+
+	resources, err := getAllResources(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != total {
+		t.Errorf("got %d resources, want %d", len(resources), total)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+}
+
+// 一个 page 失败之后不再请求剩下的 pages.
+func TestGetAllResourcesByTotalCancel(t *testing.T) {
+	const total = 100 * pageLimit
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 2 {
+			writeMockError(w, http.StatusInternalServerError, "boom")
+			return
+		}
+		resp := joplinResponse{Total: new(int), More: true}
+		*resp.Total = total
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	req := testReq(ts)
+	req.Concurrency, req.PageByTotal = 1, true
+
+	_, err := getAllResources(context.Background(), req)
+	if err == nil {
+		t.Fatal("want error")
+	}
+	if n := requests.Load(); n > 4 {
+		t.Errorf("got %d requests after page 2 failed, want pages after it skipped", n)
+	}
+}
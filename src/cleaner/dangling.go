@@ -0,0 +1,47 @@
+package cleaner
+
+import (
+	"context"
+)
+
+// a note whose body still links to deleted resources.
+type DanglingNote struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	ResourceIDs []string `json:"resource_ids"` // deleted resources linked from the note
+}
+
+// -report-dangling-after-delete: 删除之后扫描 note body, 找出仍然链接已删除 resources 的 notes.
+// API 认为没有被引用的 resources 依然可能出现在 note body 中 (eg: 没有同步完成的 note_resources 关系),
+// 删除之后这些链接就失效了. 回收站中的 notes 不检查, 和 bodyLinks() 一致.
+func danglingNotes(ctx context.Context, req Client, deleted []DeleteRecord) ([]DanglingNote, error) {
+	dangling := []DanglingNote{}
+	if len(deleted) < 1 {
+		return dangling, nil
+	}
+
+	ids := make(map[string]bool, len(deleted))
+	for _, r := range deleted {
+		ids[r.ID] = true
+	}
+
+	notes, err := getAllNotes(ctx, req, "id,title,body", false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range notes {
+		var linked []string
+		seen := make(map[string]bool)
+		for _, m := range resourceLinkRe.FindAllStringSubmatch(n.Body, -1) {
+			if ids[m[1]] && !seen[m[1]] {
+				seen[m[1]] = true
+				linked = append(linked, m[1])
+			}
+		}
+		if len(linked) > 0 {
+			dangling = append(dangling, DanglingNote{ID: n.ID, Title: n.Title, ResourceIDs: linked})
+		}
+	}
+	return dangling, nil
+}
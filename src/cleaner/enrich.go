@@ -0,0 +1,155 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// DOC: Gets resource with ID.
+// https://joplinapp.org/api/references/rest_api/#get-resources-id
+// resource 不存在时返回 errResourceGone.
+func getResource(ctx context.Context, req Client, id string) (Item, error) {
+	url := fmt.Sprintf("http://localhost:%d/resources/%s?fields=%s", req.Port, id, req.Server.resourceFields())
+
+	var item struct {
+		Item
+		Error string `json:"error"`
+	}
+	err := readRespBody(ctx, req, "GET", url, &item)
+	var ae *APIError
+	if errors.As(err, &ae) && ae.Status == http.StatusNotFound {
+		return Item{}, errResourceGone
+	}
+	if err != nil {
+		return Item{}, err
+	}
+
+	// joplin server return error.
+	if item.Error != "" {
+		return Item{}, errors.New(item.Error)
+	}
+
+	return item.Item, nil
+}
+
+// reference check 的实现, 结束后从 resources 中删除被引用的 resources,
+// 每检查完一个 resource 调用一次 onChecked. 见 filterResourcesNotify() 和 snapshotReferences().
+type referenceCheck func(ctx context.Context, req Client, resources map[string]Item, onChecked func(id string, notes int)) error
+
+// reference check 和 metadata enrichment 组成 pipeline 并发执行:
+// check 每找到一个 unused resource, 就交给 enrich workers 获取 metadata,
+// 两组 workers 各自使用 req.Concurrency 个 goroutine. 结束后 resources 中只剩下 unused resources,
+// 并且按照 ID 合并了 metadata. 被 notes 引用的 resources 记录在 d 中.
+// progress 只统计 reference check 的进度, nil 表示不需要.
+// 设置了 req.MetaCacheDir 时, updated_time 没有变化的 resources 使用缓存的 metadata, 见 metaCache.
+func scanResources(ctx context.Context, req Client, resources map[string]Item, d Decisions, check referenceCheck, progress func(Progress)) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		metas    = make(map[string]Item)
+		gone     []string // enrichment 之前被删除的 resources
+		cache    *metaCache
+	)
+
+	if req.MetaCacheDir != "" {
+		var err error
+		if cache, err = loadMetaCache(req.MetaCacheDir, req.Port, req.logger()); err != nil {
+			return err
+		}
+	}
+
+	// filter workers 会修改 resources, enrich workers 只能读取这份 copy.
+	listed := make(map[string]int64, len(resources)) // resource ID -> updated_time in listing
+	for id, item := range resources {
+		listed[id] = item.UpdatedTime
+	}
+
+	unused := make(chan string)
+	for i := 0; i < max(req.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 出错之后继续读取 channel, 避免 filter workers 阻塞.
+			for id := range unused {
+				mu.Lock()
+				failed := firstErr != nil
+				mu.Unlock()
+				if failed {
+					continue
+				}
+
+				item, err := cache.getResource(ctx, req, id, listed[id])
+
+				// resource 在 reference check 之后被删除了, 不算错误.
+				if errors.Is(err, errResourceGone) {
+					req.logger().Printf("skip %s: resource not found, deleted during scanning\n", id)
+					mu.Lock()
+					gone = append(gone, id)
+					mu.Unlock()
+					continue
+				}
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				metas[id] = item
+				mu.Unlock()
+			}
+		}()
+	}
+
+	p := newProgressReporter(progress, "filter", len(resources))
+	err := check(ctx, req, resources, func(id string, notes int) {
+		p.add(1)
+		if notes == 0 {
+			unused <- id
+			return
+		}
+
+		reason := fmt.Sprintf("kept: referenced by %d notes", notes)
+		if notes == 1 {
+			reason = "kept: referenced by 1 note"
+		}
+
+		mu.Lock()
+		d[id] = Decision{Keep: true, Notes: notes, Reason: reason}
+		mu.Unlock()
+	})
+	close(unused)
+	wg.Wait()
+	p.done()
+
+	if err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if cache != nil {
+		ids := make(map[string]bool, len(listed))
+		for id := range listed {
+			ids[id] = true
+		}
+		if err := cache.save(ids); err != nil {
+			// 缓存只影响速度, 不影响结果.
+			req.logger().Println(err)
+		}
+		req.logger().Printf("meta cache: %d hits, %d fetched\n", cache.hits, len(metas)-cache.hits)
+	}
+
+	for _, id := range gone {
+		delete(resources, id)
+	}
+
+	// join by ID
+	for id := range resources {
+		resources[id] = metas[id]
+	}
+	return nil
+}
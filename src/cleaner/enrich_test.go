@@ -0,0 +1,122 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestScanResourcesJoinsMetadata(t *testing.T) {
+	var all []Item
+	refs := make(map[string][]string)
+	for i := 0; i < 250; i++ {
+		id := fmt.Sprintf("%032x", i)
+		all = append(all, Item{ID: id, Title: "title " + id, Size: int64(i)})
+		if i%3 == 0 {
+			refs[id] = []string{"note"}
+		}
+	}
+	_, req := newMockJoplin(t, all, refs)
+
+	resources, err := getAllResources(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != len(all) {
+		t.Fatalf("got %d resources, want %d", len(resources), len(all))
+	}
+
+	if err = scanResources(context.Background(), req, resources, make(Decisions), filterResourcesNotify, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range all {
+		got, ok := resources[item.ID]
+		if _, used := refs[item.ID]; used {
+			if ok {
+				t.Errorf("%s is used, should be removed", item.ID)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s is unused, missing", item.ID)
+			continue
+		}
+		if got != item {
+			t.Errorf("%s: got %+v, want %+v", item.ID, got, item)
+		}
+	}
+}
+
+func TestScanResourcesMetaCache(t *testing.T) {
+	var all []Item
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("%032x", i)
+		all = append(all, Item{ID: id, Title: "title " + id, UpdatedTime: 1000})
+	}
+	m, req := newMockJoplin(t, all, nil)
+	req.MetaCacheDir = t.TempDir()
+
+	scan := func() map[string]Item {
+		resources, err := getAllResources(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = scanResources(context.Background(), req, resources, make(Decisions), filterResourcesNotify, nil); err != nil {
+			t.Fatal(err)
+		}
+		return resources
+	}
+
+	scan()
+	if m.gets != len(all) {
+		t.Fatalf("first run: %d metadata fetches, want %d", m.gets, len(all))
+	}
+
+	// 修改一个 resource, 只有它需要重新获取.
+	changed := all[3]
+	changed.Title, changed.UpdatedTime = "renamed", 2000
+	m.mu.Lock()
+	m.resources[changed.ID] = changed
+	m.gets = 0
+	m.mu.Unlock()
+
+	resources := scan()
+	if m.gets != 1 {
+		t.Errorf("second run: %d metadata fetches, want 1", m.gets)
+	}
+	if got := resources[changed.ID].Title; got != "renamed" {
+		t.Errorf("changed resource: got title %q, want the fresh one", got)
+	}
+	if got := resources[all[0].ID].Title; got != all[0].Title {
+		t.Errorf("cached resource: got title %q, want %q", got, all[0].Title)
+	}
+}
+
+// resource 在 reference check 之后, 获取 metadata 之前被删除.
+func TestScanResourcesGoneDuringEnrichment(t *testing.T) {
+	all := []Item{{ID: "a", Title: "a"}, {ID: "b", Title: "b"}, {ID: "c", Title: "c"}}
+	m, req := newMockJoplin(t, all, nil)
+	m.fail = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodGet && r.URL.Path == "/resources/b" {
+			delete(m.resources, "b")
+		}
+		return false
+	}
+
+	resources, err := getAllResources(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = scanResources(context.Background(), req, resources, make(Decisions), filterResourcesNotify, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := resources["b"]; ok {
+		t.Error("b is deleted during enrichment, should be removed")
+	}
+	if resources["a"] != all[0] || resources["c"] != all[2] {
+		t.Errorf("got %+v", resources)
+	}
+}
@@ -0,0 +1,408 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -filter-expr 使用的表达式, 例如:
+//
+//	size > 1000000 && mime == 'image/png'
+//	!(title == "a.png" || file_extension == "pdf")
+//
+// 支持: number, 'string' / "string", true / false, resource fields (见 resourceEnv),
+// 比较 == != < <= > >=, 逻辑 && || !, 以及括号.
+// 表达式只能读取 resource 的字段, 没有函数调用, 所以是安全的.
+type Expr interface {
+	eval(env map[string]any) (any, error)
+}
+
+type literal struct{ v any }
+
+type ident struct{ name string }
+
+type notExpr struct{ x Expr }
+
+type binaryExpr struct {
+	op   string
+	l, r Expr
+}
+
+func (e literal) eval(map[string]any) (any, error) { return e.v, nil }
+
+func (e ident) eval(env map[string]any) (any, error) {
+	v, ok := env[e.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", e.name)
+	}
+	return v, nil
+}
+
+func (e notExpr) eval(env map[string]any) (any, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operator ! needs a bool, got %v", v)
+	}
+	return !b, nil
+}
+
+func (e binaryExpr) eval(env map[string]any) (any, error) {
+	l, err := e.l.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// && 和 || 短路求值.
+	if e.op == "&&" || e.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s needs bools, got %v", e.op, l)
+		}
+		if (e.op == "&&" && !lb) || (e.op == "||" && lb) {
+			return lb, nil
+		}
+		r, err := e.r.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s needs bools, got %v", e.op, r)
+		}
+		return rb, nil
+	}
+
+	r, err := e.r.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	var c int
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("can't compare number %v with %v", lv, r)
+		}
+		c = compare(lv, rv)
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't compare string %q with %v", lv, r)
+		}
+		c = strings.Compare(lv, rv)
+	case bool:
+		rv, ok := r.(bool)
+		if !ok || (e.op != "==" && e.op != "!=") {
+			return nil, fmt.Errorf("can't compare bool %v with %v using %s", lv, r, e.op)
+		}
+		if lv != rv {
+			c = 1
+		}
+	}
+
+	switch e.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default: // ">="
+		return c >= 0, nil
+	}
+}
+
+func compare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// 表达式中可以使用的 resource fields.
+func resourceEnv(item Item) map[string]any {
+	return map[string]any{
+		"id":                item.ID,
+		"title":             item.Title,
+		"mime":              item.Mime,
+		"size":              float64(item.Size),
+		"file_extension":    item.FileExtension,
+		"blob_updated_time": float64(item.BlobUpdatedTime),
+		"created_time":      float64(item.CreatedTime),
+		"updated_time":      float64(item.UpdatedTime),
+	}
+}
+
+// 对 resource 求值, 结果必须是 bool.
+func matchResource(e Expr, item Item) (bool, error) {
+	v, err := e.eval(resourceEnv(item))
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("filter expression returns %v, not a bool", v)
+	}
+	return b, nil
+}
+
+// recursive descent parser:
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = primary [ ("==" | "!=" | "<" | "<=" | ">" | ">=") primary ]
+//	primary = number | string | "true" | "false" | field | "(" or ")"
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func ParseExpr(s string) (Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty filter expression")
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	// 提前检查 field 名称和类型, 避免 listing 和 reference check 之后才报错.
+	// fields 的类型是固定的, 所以用 zero value 就可以推断出每个子表达式的类型.
+	t, err := typeOf(e, resourceEnv(Item{}))
+	if err != nil {
+		return nil, err
+	}
+	if t != "bool" {
+		return nil, fmt.Errorf("filter expression returns a %s, not a bool", t)
+	}
+	return e, nil
+}
+
+// 返回 number | string | bool. 检查每个子表达式, && 和 || 不短路.
+func typeOf(e Expr, env map[string]any) (string, error) {
+	switch e := e.(type) {
+	case notExpr:
+		t, err := typeOf(e.x, env)
+		if err != nil {
+			return "", err
+		}
+		if t != "bool" {
+			return "", fmt.Errorf("operator ! needs a bool, got a %s", t)
+		}
+		return "bool", nil
+	case binaryExpr:
+		l, err := typeOf(e.l, env)
+		if err != nil {
+			return "", err
+		}
+		r, err := typeOf(e.r, env)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case e.op == "&&" || e.op == "||":
+			if l != "bool" || r != "bool" {
+				return "", fmt.Errorf("operator %s needs bools, got a %s and a %s", e.op, l, r)
+			}
+		case l != r:
+			return "", fmt.Errorf("can't compare a %s with a %s", l, r)
+		case l == "bool" && e.op != "==" && e.op != "!=":
+			return "", fmt.Errorf("can't compare bools using %s", e.op)
+		}
+		return "bool", nil
+	}
+
+	v, err := e.eval(env)
+	if err != nil {
+		return "", err
+	}
+	switch v.(type) {
+	case float64:
+		return "number", nil
+	case string:
+		return "string", nil
+	default:
+		return "bool", nil
+	}
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: "||", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: "&&", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peek() == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (Expr, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		r, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr{op: op, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, errors.New("unexpected end of filter expression")
+	case t == "(":
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing )")
+		}
+		return e, nil
+	case t == "true" || t == "false":
+		return literal{v: t == "true"}, nil
+	case t[0] == '\'' || t[0] == '"':
+		return literal{v: t[1 : len(t)-1]}, nil
+	case t[0] >= '0' && t[0] <= '9':
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t)
+		}
+		return literal{v: f}, nil
+	case unicode.IsLetter(rune(t[0])) || t[0] == '_':
+		return ident{name: t}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", t)
+}
+
+// 拆分成 tokens, string token 保留引号.
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		case strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||") ||
+			strings.HasPrefix(s[i:], "==") || strings.HasPrefix(s[i:], "!=") ||
+			strings.HasPrefix(s[i:], "<=") || strings.HasPrefix(s[i:], ">="):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("()!<>", rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		case c >= '0' && c <= '9' || c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// 只保留表达式结果为 true 的 resources.
+func applyFilterExpr(resources map[string]Item, d Decisions, e Expr) error {
+	for id, item := range resources {
+		ok, err := matchResource(e, item)
+		if err != nil {
+			return fmt.Errorf("filter %s: %w", id, err)
+		}
+		if !ok {
+			d.Keep(resources, id, "excluded by -filter-expr")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package cleaner
+
+import "testing"
+
+func TestFilterExpr(t *testing.T) {
+	item := Item{ID: "abc", Title: "a.png", Mime: "image/png", Size: 2000000, FileExtension: "png", CreatedTime: 1650000000000, UpdatedTime: 1690000000000}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"size > 1000000 && mime == 'image/png'", true},
+		{"size > 1000000 && mime == \"application/pdf\"", false},
+		{"size <= 2000000", true},
+		{"size < 1.5e6", false},
+		{"!(title == 'a.png' || file_extension == 'pdf')", false},
+		{"mime != 'image/png' || size >= 2000000", true},
+		{"true && !false", true},
+		{"id == 'abc' && (size < 1 || mime == 'image/png')", true},
+		{"updated_time < 1700000000000 && created_time >= 1600000000000", true},
+	}
+
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		got, err := matchResource(e, item)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestFilterExprErrors(t *testing.T) {
+	parseErrors := []string{
+		"",
+		"size >",
+		"(size > 1",
+		"unknown == 1",
+		"mime == 'image/png",
+		"size > 1 size",
+		"size $ 1",
+		// 类型错误在解析时报错, 不需要等到 filter phase.
+		"size == 'big'",
+		"size > '1MB'",
+		"size",
+		"!mime",
+		"size >= 0 && title",
+		"size < 0 && size > 'x'", // 短路求值时不会检查右边
+		"title == 'a' || size",
+		"true < false",
+	}
+	for _, s := range parseErrors {
+		if _, err := ParseExpr(s); err == nil {
+			t.Errorf("%q: expect parse error", s)
+		}
+	}
+}
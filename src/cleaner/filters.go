@@ -0,0 +1,169 @@
+package cleaner
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// why a resource is kept or deleted.
+type Decision struct {
+	Keep   bool
+	Notes  int    // number of notes referencing the resource
+	Reason string // eg: "kept: referenced by 2 notes", "delete: unused, 4.2MiB"
+
+	Item     Item      // metadata when the resource is kept or marked for deleting, only ID if kept by references
+	Verdicts []Verdict // result of each filter the resource went through, in order, see Decisions.step()
+}
+
+// result of one filter for one resource.
+type Verdict struct {
+	Filter string `json:"filter"`
+	Pass   bool   `json:"pass"`             // false means kept by this filter
+	Reason string `json:"reason,omitempty"` // why kept
+}
+
+// resource ID -> decision, 记录 filtering pipeline 中每个 resource 的处理结果.
+type Decisions map[string]Decision
+
+// 保留 resource: 从 map 中移除, 并记录原因.
+func (d Decisions) Keep(resources map[string]Item, id, reason string) {
+	delete(resources, id)
+	dc := d[id]
+	dc.Keep, dc.Reason = true, "kept: "+reason
+	d[id] = dc
+}
+
+// 经过所有 filters 之后剩下的 resources 将被删除.
+func (d Decisions) MarkDeletes(resources map[string]Item) {
+	for id, item := range resources {
+		dc := d[id]
+		dc.Reason, dc.Item = "delete: unused, "+FormatBytes(item.Size), item
+		d[id] = dc
+	}
+}
+
+// 执行名为 name 的 filter, 为执行前 resources 中的每个 resource 记录 verdict:
+// 执行后依然在 resources 中的为 pass, 被移除的为 kept. 已经被保留的 resources 不再经过之后的 filters.
+func (d Decisions) step(name string, resources map[string]Item, filter func() error) error {
+	before := make(map[string]Item, len(resources))
+	for id, item := range resources {
+		before[id] = item
+	}
+
+	if err := filter(); err != nil {
+		return err
+	}
+
+	for id, item := range before {
+		v := Verdict{Filter: name, Pass: true}
+		dc := d[id]
+		if _, ok := resources[id]; !ok {
+			// 没有记录原因的是在扫描过程中被删除的 resources, 见 filterResourcesNotify().
+			if dc.Reason == "" {
+				dc.Keep, dc.Reason = true, "skipped: resource not found, deleted during scanning"
+			}
+			v.Pass, v.Reason = false, dc.Reason
+			dc.Item = item
+		}
+		dc.Verdicts = append(dc.Verdicts, v)
+		d[id] = dc
+	}
+	return nil
+}
+
+// verbose 时打印每个 resource 的处理结果;
+// 否则只打印被 filters 保留的 unused resources, 被 notes 引用的 resources 不打印.
+func (d Decisions) Print(w io.Writer, verbose bool) {
+	ids := make([]string, 0, len(d))
+	for id := range d {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		dc := d[id]
+		if verbose || (dc.Keep && dc.Notes == 0) {
+			fmt.Fprintf(w, "%s %s\n", id, dc.Reason)
+		}
+	}
+}
+
+// resource 文件在 LockedWindow 内被修改过, 视为正在被编辑或同步.
+const LockedWindow = 10 * time.Minute
+
+// Joplin API 没有暴露 resource 的 lock / in-use 状态, 这里用 blob_updated_time 作为替代:
+// 最近被修改过的 resource 可能正在被编辑或同步, 删除可能会造成冲突.
+func skipLockedResources(resources map[string]Item, d Decisions, now time.Time) {
+	for id, item := range resources {
+		if now.Sub(time.UnixMilli(item.BlobUpdatedTime)) < LockedWindow {
+			d.Keep(resources, id, "file updated at "+time.UnixMilli(item.BlobUpdatedTime).Format(time.RFC3339)+", may be in use")
+		}
+	}
+}
+
+// 保留 cutoff 之后更新过的 resources.
+func skipNewerResources(resources map[string]Item, d Decisions, cutoff time.Time) {
+	for id, item := range resources {
+		if time.UnixMilli(item.UpdatedTime).After(cutoff) {
+			d.Keep(resources, id, "newer than cutoff, updated at "+time.UnixMilli(item.UpdatedTime).Format(time.RFC3339))
+		}
+	}
+}
+
+// size 为 0 的 resource 可能是文件还没有同步完成.
+func skipZeroSizeResources(resources map[string]Item, d Decisions) {
+	for id, item := range resources {
+		if item.Size == 0 {
+			d.Keep(resources, id, "zero size")
+		}
+	}
+}
+
+// -backup-dir 时, 超过 -max-download-size 的 resources 不会被下载, 没有备份就不删除.
+func skipTooLargeToBackUp(resources map[string]Item, d Decisions, maxSize int64) {
+	for id, item := range resources {
+		if item.Size > maxSize {
+			d.Keep(resources, id, "exceeds -max-download-size, not backed up")
+		}
+	}
+}
+
+// 保留 -keep-file 中列出的 resources.
+func skipKeptIDs(resources map[string]Item, d Decisions, ids []string) {
+	for _, id := range ids {
+		if _, ok := resources[id]; ok {
+			d.Keep(resources, id, "listed in -keep-file")
+		}
+	}
+}
+
+// 只删除 -only-ids 中列出的 resources.
+func skipUnlistedIDs(resources map[string]Item, d Decisions, ids []string) {
+	listed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		listed[id] = true
+	}
+
+	for id := range resources {
+		if !listed[id] {
+			d.Keep(resources, id, "not in -only-ids")
+		}
+	}
+}
+
+// 无论其他 options 如何, 都不删除这些 MIME types 的 resources.
+// mimes 中的 "type/*" 匹配该 type 的所有 subtypes, eg: "image/*".
+func skipProtectedMimes(resources map[string]Item, d Decisions, mimes []string) {
+	for id, item := range resources {
+		for _, m := range mimes {
+			prefix, wildcard := strings.CutSuffix(m, "*")
+			if item.Mime == m || (wildcard && strings.HasPrefix(item.Mime, prefix)) {
+				d.Keep(resources, id, "mime "+item.Mime+" is in -never-delete-mime")
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSkipProtectedMimes(t *testing.T) {
+	resources := map[string]Item{
+		"pdf":  {ID: "pdf", Mime: "application/pdf"},
+		"png":  {ID: "png", Mime: "image/png"},
+		"jpeg": {ID: "jpeg", Mime: "image/jpeg"},
+		"zip":  {ID: "zip", Mime: "application/zip"},
+		"none": {ID: "none"},
+	}
+	d := make(Decisions)
+	skipProtectedMimes(resources, d, []string{"application/pdf", "image/*"})
+
+	for _, id := range []string{"pdf", "png", "jpeg"} {
+		if _, ok := resources[id]; ok || !d[id].Keep {
+			t.Errorf("%s should be kept", id)
+		}
+	}
+	for _, id := range []string{"zip", "none"} {
+		if _, ok := resources[id]; !ok {
+			t.Errorf("%s should not be kept: %s", id, d[id].Reason)
+		}
+	}
+}
+
+func TestDecisionsStep(t *testing.T) {
+	resources := map[string]Item{
+		"a": {ID: "a", Size: 0},
+		"b": {ID: "b", Size: 10, Mime: "image/png"},
+		"c": {ID: "c", Size: 10, Mime: "application/pdf"},
+	}
+	d := make(Decisions)
+
+	_ = d.step("protect-zero-size", resources, func() error { skipZeroSizeResources(resources, d); return nil })
+	_ = d.step("never-delete-mime", resources, func() error { skipProtectedMimes(resources, d, []string{"image/*"}); return nil })
+	d.MarkDeletes(resources)
+
+	for id, want := range map[string]string{
+		"a": "protect-zero-size:false",
+		"b": "protect-zero-size:true,never-delete-mime:false",
+		"c": "protect-zero-size:true,never-delete-mime:true",
+	} {
+		var got []string
+		for _, v := range d[id].Verdicts {
+			got = append(got, fmt.Sprintf("%s:%v", v.Filter, v.Pass))
+		}
+		if strings.Join(got, ",") != want {
+			t.Errorf("%s: got verdicts %v, want %s", id, got, want)
+		}
+		if d[id].Item.ID != id {
+			t.Errorf("%s: metadata not recorded", id)
+		}
+	}
+	if d["c"].Keep || !d["b"].Keep {
+		t.Errorf("got %+v, want b kept and c deleted", d)
+	}
+}
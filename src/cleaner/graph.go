@@ -0,0 +1,90 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// graph 中的一个 resource 以及引用它的 notes (adjacency list).
+type GraphNode struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Notes []Item `json:"notes"`
+}
+
+// 获取所有 resources 以及引用它们的 notes, 包括 unused resources, 按 resource ID 排序.
+// 使用 req.Concurrency 个 goroutine 并发查询, 每个 resource 需要两个请求.
+func (req Client) BuildGraph(ctx context.Context) ([]GraphNode, error) {
+	resources, err := getAllResources(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		nodes    []GraphNode
+	)
+
+	ids := make(chan string)
+	for i := 0; i < max(req.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				node, err := getGraphNode(ctx, req, id)
+
+				// resource 在查询过程中被删除了, 不算错误.
+				if errors.Is(err, errResourceGone) {
+					continue
+				}
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				nodes = append(nodes, node)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, id := range SortedIDs(resources) {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes, nil
+}
+
+func getGraphNode(ctx context.Context, req Client, id string) (GraphNode, error) {
+	notes, err := getResourceNotes(ctx, req, id, "id,title")
+	if err != nil {
+		return GraphNode{}, err
+	}
+
+	item, err := getResource(ctx, req, id)
+	if err != nil {
+		return GraphNode{}, err
+	}
+
+	if notes == nil {
+		notes = []Item{}
+	}
+	return GraphNode{ID: id, Title: item.Title, Notes: notes}, nil
+}
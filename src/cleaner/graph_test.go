@@ -0,0 +1,22 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestBuildGraph(t *testing.T) {
+	id := func(i int) string { return fmt.Sprintf("%032x", i) }
+	all := []Item{{ID: id(0), Title: "a.png"}, {ID: id(1), Title: "b.pdf"}}
+	_, req := newMockJoplin(t, all, map[string][]string{id(0): {"n1", "n2"}})
+
+	nodes, err := req.BuildGraph(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].ID != id(0) || len(nodes[0].Notes) != 2 || nodes[1].Title != "b.pdf" || len(nodes[1].Notes) != 0 {
+		t.Fatalf("got %+v", nodes)
+	}
+
+}
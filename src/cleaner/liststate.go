@@ -0,0 +1,161 @@
+package cleaner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// getAllResources() 的进度, 每完成一页保存一次, 中断之后从下一页继续.
+// resources 按 ID 排序, 中断期间新增或删除的 resources 可能导致漏掉或重复个别 resources,
+// 漏掉的只是不会被删除, 所以是安全的.
+//
+// path 中只保存 cursor, 每页的 IDs 追加到 listIDsPath(path), 每页的 I/O 不随已完成的页数增长.
+type listState struct {
+	Port    int       `json:"port"` // 不同的 joplin instance 不能共用
+	Page    int       `json:"page"` // 最后完成的 page
+	SavedAt time.Time `json:"saved_at"`
+
+	IDs []string `json:"-"` // 已完成的 pages 中的 IDs, 从 listIDsPath(path) 中读取
+}
+
+// listIDsPath(path) 中的一行.
+type listPage struct {
+	Page int      `json:"page"`
+	IDs  []string `json:"ids"`
+}
+
+func listIDsPath(path string) string { return path + ".ids" }
+
+// 文件不存在或者属于其他 instance 时返回 zero value, 从第一页开始.
+func loadListState(path string, port int, l *log.Logger) (listState, error) {
+	var s listState
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, removeListState(path) // 之前的 IDs 不能使用
+	}
+	if err != nil {
+		return s, err
+	}
+
+	if err = json.Unmarshal(b, &s); err != nil {
+		return listState{}, err
+	}
+	if s.Port != port {
+		l.Printf("warning: %s was saved for port %d, listing from page 1\n", path, s.Port)
+		return listState{}, removeListState(path)
+	}
+
+	if s.IDs, err = loadListIDs(listIDsPath(path), s.Page, l); err != nil {
+		return listState{}, err
+	}
+
+	l.Printf("resuming listing from page %d, %d resources saved at %s\n", s.Page+1, len(s.IDs), s.SavedAt.Format(time.RFC3339))
+	return s, nil
+}
+
+// 读取 1 到 page 页的 IDs, 并把文件截断到第 page 页之后.
+// 之后的 pages 是在保存 cursor 之前中断的, 会重新请求并再次追加, 所以截断以免同一页出现两次.
+// 同一页有多行时 (旧版本留下的) 使用最后一行, 不完整或损坏的行忽略, 不会导致之后每次 resume 都失败.
+func loadListIDs(path string, page int, l *log.Logger) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pages := make(map[int][]string)
+	var offset, keep int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(line) == 0 {
+			break
+		}
+		offset += int64(len(line))
+
+		var p listPage
+		if line[len(line)-1] != '\n' || json.Unmarshal(line, &p) != nil {
+			l.Printf("warning: %s: skip a damaged line at byte %d\n", path, offset-int64(len(line)))
+			continue
+		}
+		if p.Page <= page {
+			pages[p.Page] = p.IDs
+			keep = offset
+		}
+	}
+
+	var ids []string
+	for i := 1; i <= page; i++ {
+		p, ok := pages[i]
+		if !ok {
+			return nil, fmt.Errorf("%s: page %d of %d is missing", path, i, page)
+		}
+		ids = append(ids, p...)
+	}
+
+	if err = os.Truncate(path, keep); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// 先追加这一页的 IDs, 再保存 cursor; 中断时 cursor 不会超过已经保存的 IDs.
+func saveListPage(path string, s listState, ids []string) error {
+	f, err := os.OpenFile(listIDsPath(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(f).Encode(listPage{Page: s.Page, IDs: ids}); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	s.SavedAt = time.Now()
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// 删除 cursor 和 IDs 文件, 不存在时不算错误.
+func removeListState(path string) error {
+	for _, p := range []string{path, listIDsPath(path)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// 先写入临时文件再 rename, 中断时不会留下不完整的文件.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,136 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGetAllResourcesResume(t *testing.T) {
+	var all []Item
+	for i := 0; i < 250; i++ {
+		all = append(all, Item{ID: fmt.Sprintf("%032x", i)})
+	}
+	_, req := newMockJoplin(t, all, nil)
+	req.ListStateFile = filepath.Join(t.TempDir(), "list.json")
+
+	// 第一页已经完成. 用不存在的 ID 代替第一页, 证明没有重新请求第一页.
+	saved := listState{Port: req.Port, Page: 1}
+	for i := 0; i < pageLimit; i++ {
+		saved.IDs = append(saved.IDs, fmt.Sprintf("saved%027x", i))
+	}
+	if err := saveListPage(req.ListStateFile, saved, saved.IDs); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二页的 IDs 已经追加, 但是在保存 cursor 之前中断了, 并且最后一行只写了一半.
+	f, err := os.OpenFile(listIDsPath(req.ListStateFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "{\"page\":2,\"ids\":[\"stale%027x\"]}\n{\"page\":3,\"ids\":[\"tru", 0)
+	f.Close()
+
+	resources, err := getAllResources(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != len(all) {
+		t.Errorf("got %d resources, want %d", len(resources), len(all))
+	}
+	if _, ok := resources[saved.IDs[0]]; !ok {
+		t.Error("saved IDs are not used")
+	}
+	if _, ok := resources[all[0].ID]; ok {
+		t.Error("page 1 is fetched again")
+	}
+	if _, ok := resources[fmt.Sprintf("stale%027x", 0)]; ok {
+		t.Error("IDs of a page after the cursor are used")
+	}
+
+	for _, path := range []string{req.ListStateFile, listIDsPath(req.ListStateFile)} {
+		if _, err = os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s should be removed after listing, got %v", path, err)
+		}
+	}
+}
+
+// 在追加 IDs 之后, 保存 cursor 之前中断, 之后 resume 的运行再中断一次.
+func TestLoadListStateAfterCrash(t *testing.T) {
+	page := func(n int) []string { return []string{fmt.Sprintf("p%d-a", n), fmt.Sprintf("p%d-b", n)} }
+
+	for _, tc := range []struct {
+		name  string
+		crash string // 中断时 IDs 文件中多出的内容
+	}{
+		{"page appended twice", `{"page":2,"ids":["p2-a","p2-b"]}` + "\n"},
+		{"partial line", `{"page":2,"ids":["p2`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "list.json")
+			if err := saveListPage(path, listState{Port: 1, Page: 1}, page(1)); err != nil {
+				t.Fatal(err)
+			}
+
+			// 第一次中断.
+			f, err := os.OpenFile(listIDsPath(path), os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.WriteString(tc.crash)
+			f.Close()
+
+			s, err := loadListState(path, 1, discardLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Page != 1 || len(s.IDs) != 2 {
+				t.Fatalf("got page %d, IDs %v, want page 1 with 2 IDs", s.Page, s.IDs)
+			}
+
+			// resume 之后重新请求第二页并保存, 然后在第三页再次中断.
+			s.Page = 2
+			if err = saveListPage(path, s, page(2)); err != nil {
+				t.Fatal(err)
+			}
+			f, err = os.OpenFile(listIDsPath(path), os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.WriteString(`{"page":3,"ids":["p3-a"]}` + "\n")
+			f.Close()
+
+			s, err = loadListState(path, 1, discardLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append(page(1), page(2)...)
+			if !slices.Equal(s.IDs, want) {
+				t.Errorf("got IDs %v, want %v", s.IDs, want)
+			}
+		})
+	}
+}
+
+func TestLoadListIDsDamagedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.json.ids")
+	content := `{"page":1,"ids":["a"]}` + "\n" +
+		`{"page":2,"ids":["stale"]}` + "\n" +
+		`{"page":2,"ids":["tru{"page":2,"ids":["b"]}` + "\n" + // 半行之后追加的内容
+		`{"page":2,"ids":["b"]}` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := loadListIDs(path, 2, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []string{"a", "b"}) {
+		t.Errorf("got %v, want the last entry of each page", ids)
+	}
+}
@@ -0,0 +1,106 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// resource ID -> metadata 的缓存, 以 updated_time 为 key, 未修改的 resources 不需要再次 GET /resources/:id.
+// 只缓存 enrichment 获取的 metadata, reference check 每次都会重新执行.
+// 每个 joplin instance (port) 使用单独的文件. nil 表示不使用缓存.
+type metaCache struct {
+	path string
+
+	mu    sync.Mutex
+	items map[string]Item
+	hits  int
+}
+
+// 文件不存在时返回空的缓存; 文件损坏时只打印 warning, 重新获取所有 metadata.
+func loadMetaCache(dir string, port int, l *log.Logger) (*metaCache, error) {
+	c := &metaCache{
+		path:  filepath.Join(dir, fmt.Sprintf("resources-%d.json", port)),
+		items: make(map[string]Item),
+	}
+
+	b, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &c.items); err != nil {
+		l.Printf("warning: %s is invalid, ignoring it: %v\n", c.path, err)
+		c.items = make(map[string]Item)
+	}
+	return c, nil
+}
+
+// updated_time 不同说明 resource 被修改过, 缓存失效.
+// updated_time 为 0 (eg: 从 -list-state-file 恢复的 resources) 时总是 miss.
+func (c *metaCache) get(id string, updatedTime int64) (Item, bool) {
+	if c == nil || updatedTime == 0 {
+		return Item{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[id]
+	if !ok || item.UpdatedTime != updatedTime {
+		return Item{}, false
+	}
+	c.hits++
+	return item, true
+}
+
+func (c *metaCache) put(item Item) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[item.ID] = item
+}
+
+// 缓存中没有时通过 getResource() 获取并加入缓存. nil cache 总是 getResource().
+func (c *metaCache) getResource(ctx context.Context, req Client, id string, updatedTime int64) (Item, error) {
+	if item, ok := c.get(id, updatedTime); ok {
+		return item, nil
+	}
+
+	item, err := getResource(ctx, req, id)
+	if err == nil {
+		c.put(item)
+	}
+	return item, err
+}
+
+// 删除 listed 中不存在的 resources, 然后保存.
+func (c *metaCache) save(listed map[string]bool) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.items {
+		if !listed[id] {
+			delete(c.items, id)
+		}
+	}
+
+	b, err := json.Marshal(c.items)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, b)
+}
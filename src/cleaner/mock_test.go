@@ -0,0 +1,150 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const mockToken = "token"
+
+// 模拟 Joplin Web Clipper service 的 resources API.
+type mockJoplin struct {
+	mu        sync.Mutex
+	token     string
+	resources map[string]Item     // resource ID -> metadata
+	refs      map[string][]string // resource ID -> note IDs
+	notes     []Item
+	folders   []Item
+	gets      int // GET /resources/:id 的次数
+
+	// 检查 token 之后调用 (if not nil), 返回 true 表示已经处理了 request, 用于模拟 server 出错.
+	fail func(w http.ResponseWriter, r *http.Request) bool
+}
+
+func newMockJoplin(t *testing.T, resources []Item, refs map[string][]string) (*mockJoplin, Client) {
+	m := &mockJoplin{
+		token:     mockToken,
+		resources: make(map[string]Item),
+		refs:      refs,
+	}
+	for _, r := range resources {
+		m.resources[r.ID] = r
+	}
+
+	ts := httptest.NewServer(m)
+	t.Cleanup(ts.Close)
+	return m, testReq(ts)
+}
+
+// 连接 ts 的 Client, token 为 mockJoplin 的 token.
+func testReq(ts *httptest.Server) Client {
+	u, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return Client{Port: port, Token: mockToken, Concurrency: 4}
+}
+
+func (m *mockJoplin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r.URL.Path == "/ping" {
+		w.Write([]byte(joplinPingResponse))
+		return
+	}
+
+	if r.URL.Query().Get("token") != m.token {
+		writeMockError(w, http.StatusForbidden, `Invalid "token" parameter`)
+		return
+	}
+
+	if m.fail != nil && m.fail(w, r) {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "resources":
+		m.listResources(w, r)
+	case len(parts) == 1 && parts[0] == "notes":
+		writeMockPage(w, r, m.notes)
+	case len(parts) == 1 && parts[0] == "folders":
+		writeMockPage(w, r, m.folders)
+	case len(parts) == 2 && parts[0] == "resources":
+		item, ok := m.resources[parts[1]]
+		if !ok {
+			writeMockError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(m.resources, parts[1])
+			return
+		}
+		m.gets++
+		json.NewEncoder(w).Encode(item)
+	case len(parts) == 3 && parts[0] == "resources" && parts[2] == "file":
+		item, ok := m.resources[parts[1]]
+		if !ok {
+			writeMockError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		w.Write(make([]byte, item.Size))
+	case len(parts) == 3 && parts[0] == "resources" && parts[2] == "notes":
+		if _, ok := m.resources[parts[1]]; !ok {
+			writeMockError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		var notes []Item
+		for _, n := range m.refs[parts[1]] {
+			notes = append(notes, Item{ID: n})
+		}
+		writeMockPage(w, r, notes)
+	case len(parts) == 3 && parts[0] == "notes" && parts[2] == "resources":
+		var resources []Item
+		for _, id := range SortedIDs(m.resources) {
+			if slices.Contains(m.refs[id], parts[1]) {
+				resources = append(resources, m.resources[id])
+			}
+		}
+		writeMockPage(w, r, resources)
+	default:
+		writeMockError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// 只返回 id 和 updated_time, 每页 limit 个.
+func (m *mockJoplin) listResources(w http.ResponseWriter, r *http.Request) {
+	ids := make([]string, 0, len(m.resources))
+	for id := range m.resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	items := make([]Item, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, Item{ID: id, UpdatedTime: m.resources[id].UpdatedTime})
+	}
+	writeMockPage(w, r, items)
+}
+
+// 按 limit / page 分页返回 items, 不处理 fields.
+func writeMockPage(w http.ResponseWriter, r *http.Request, items []Item) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	start := min((page-1)*limit, len(items))
+	end := min(start+limit, len(items))
+
+	json.NewEncoder(w).Encode(joplinResponse{Items: items[start:end], More: end < len(items)})
+}
+
+func writeMockError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(joplinResponse{Error: msg})
+}
@@ -0,0 +1,92 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DOC: Gets all notes.
+// https://joplinapp.org/api/references/rest_api/#get-notes
+// https://joplinapp.org/api/references/rest_api/#pagination
+// includeDeleted 时同时返回回收站中的 notes.
+func getAllNotes(ctx context.Context, req Client, fields string, includeDeleted bool) (notes []Item, err error) {
+	var mark = true
+	for page := 1; mark; page++ {
+		url := fmt.Sprintf("http://localhost:%d/notes?fields=%s&order_by=id&limit=%d&page=%d", req.Port, fields, pageLimit, page)
+		if includeDeleted {
+			url += "&include_deleted=1"
+		}
+		var resp joplinResponse
+		err := readRespBody(ctx, req, "GET", url, &resp)
+		if err != nil {
+			return nil, err
+		}
+
+		// joplin server return error.
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+
+		notes = append(notes, resp.Items...)
+		mark = resp.More
+	}
+
+	return notes, nil
+}
+
+// DOC: Gets the resources associated with the note.
+// https://joplinapp.org/api/references/rest_api/#get-notes-id-resources
+// https://joplinapp.org/api/references/rest_api/#pagination
+func getNoteResources(ctx context.Context, req Client, noteID string) (resources []Item, err error) {
+	var mark = true
+	for page := 1; mark; page++ {
+		url := fmt.Sprintf("http://localhost:%d/notes/%s/resources?fields=id,title&order_by=id&limit=%d&page=%d", req.Port, noteID, pageLimit, page)
+
+		var resp joplinResponse
+		err = readRespBody(ctx, req, "GET", url, &resp)
+		if err != nil {
+			return nil, err
+		}
+
+		// joplin server return error.
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+
+		resources = append(resources, resp.Items...)
+		mark = resp.More
+	}
+
+	return resources, nil
+}
+
+// a conflict note and the resources it references.
+type ConflictNote struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Resources []Item `json:"resources"`
+}
+
+// 同步冲突时 Joplin 会生成 conflict note, conflict note 引用的 resources 不会被认为是 unused.
+func (req Client) ListConflicts(ctx context.Context) ([]ConflictNote, error) {
+	notes, err := getAllNotes(ctx, req, "id,title,is_conflict", false)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []ConflictNote{}
+	for _, n := range notes {
+		if n.IsConflict == 0 {
+			continue
+		}
+
+		res, err := getNoteResources(ctx, req, n.ID)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, ConflictNote{ID: n.ID, Title: n.Title, Resources: res})
+	}
+
+	return conflicts, nil
+}
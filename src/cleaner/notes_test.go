@@ -0,0 +1,30 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestListConflictsPages(t *testing.T) {
+	var all []Item
+	refs := make(map[string][]string)
+	for i := 0; i < pageLimit*2+1; i++ {
+		id := fmt.Sprintf("%032x", i)
+		all = append(all, Item{ID: id, Title: "title " + id})
+		refs[id] = []string{"conflict"}
+	}
+	m, req := newMockJoplin(t, all, refs)
+	m.notes = []Item{{ID: "conflict", Title: "c", IsConflict: 1}, {ID: "note", Title: "n"}}
+
+	conflicts, err := req.ListConflicts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].ID != "conflict" {
+		t.Fatalf("got %+v, want only the conflict note", conflicts)
+	}
+	if got := conflicts[0].Resources; len(got) != len(all) || got[len(got)-1] != all[len(all)-1] {
+		t.Errorf("got %d resources, want %d", len(got), len(all))
+	}
+}
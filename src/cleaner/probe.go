@@ -0,0 +1,116 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// /ping 的返回内容.
+const joplinPingResponse = "JoplinClipperServer"
+
+// Joplin 的 REST API 没有提供版本号, 只能通过探测 API 的行为来判断版本之间的差异.
+// 所有和 Joplin 版本相关的逻辑都集中在这里, zero value 表示已测试过的 Joplin 版本的行为.
+type Server struct {
+	untested          bool // /ping 的返回不是 joplinPingResponse
+	noBlobUpdatedTime bool // 旧版本 resources 没有 blob_updated_time 字段
+}
+
+// GET /resources/:id 时需要的 metadata fields.
+func (s Server) resourceFields() string {
+	fields := []string{"id", "title", "mime", "size", "file_extension", "created_time", "updated_time"}
+	if !s.noBlobUpdatedTime {
+		fields = append(fields, "blob_updated_time")
+	}
+	return strings.Join(fields, ",")
+}
+
+// 检查 server 是否是 Joplin, 以及 API 支持的 fields.
+func (req Client) Probe(ctx context.Context) (Server, error) {
+	var s Server
+
+	body, err := ping(ctx, req)
+	if err != nil {
+		return s, err
+	}
+
+	if string(body) != joplinPingResponse {
+		s.untested = true
+		req.logger().Printf("warning: untested server, /ping returns %q, expected %q\n", body, joplinPingResponse)
+	}
+
+	// 不存在的 field 会导致 joplin 返回 error.
+	url := fmt.Sprintf("http://localhost:%d/resources?fields=id,blob_updated_time&limit=1", req.Port)
+	var r joplinResponse
+	err = readRespBody(ctx, req, "GET", url, &r)
+	if err == nil && r.Error != "" {
+		err = errors.New(r.Error)
+	}
+
+	if err != nil {
+		// token 错误等其他错误.
+		if !strings.Contains(err.Error(), "blob_updated_time") {
+			return s, err
+		}
+
+		s.noBlobUpdatedTime = true
+		req.logger().Println("warning: untested joplin version, resources have no blob_updated_time, locked resources can't be detected")
+	}
+
+	return s, nil
+}
+
+const (
+	probeRounds    = 3
+	minConcurrency = 2
+	maxConcurrency = 16
+)
+
+// DOC: Ping the service.
+// https://joplinapp.org/api/references/rest_api/#ping
+func ping(ctx context.Context, req Client) ([]byte, error) {
+	r, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://localhost:%d/ping", req.Port), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := req.httpClient().Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// returns average latency of probeRounds pings.
+func pingLatency(ctx context.Context, req Client) (time.Duration, error) {
+	var total time.Duration
+	for i := 0; i < probeRounds; i++ {
+		start := time.Now()
+		if _, err := ping(ctx, req); err != nil {
+			return 0, err
+		}
+		total += time.Since(start)
+	}
+
+	return total / probeRounds, nil
+}
+
+// 根据单个请求的延迟选择默认的并发数.
+// 本地 Joplin (~1ms) 的瓶颈在 server 端, 并发数不需要太大;
+// 延迟越高, 越需要更多的并发请求来填满等待时间.
+func (req Client) ProbeConcurrency(ctx context.Context) int {
+	latency, err := pingLatency(ctx, req)
+	if err != nil {
+		// 探测失败不影响运行, 后续的请求会报出真正的错误.
+		return minConcurrency
+	}
+
+	c := minConcurrency + int(latency/(5*time.Millisecond))
+	return min(max(c, minConcurrency), maxConcurrency)
+}
@@ -0,0 +1,80 @@
+package cleaner
+
+import (
+	"sync"
+	"time"
+)
+
+// 两次 progress 回调之间的最小间隔, 每个 phase 的第一次和最后一次回调不受限制.
+const progressInterval = 200 * time.Millisecond
+
+// progress of a phase, see Options.Progress.
+type Progress struct {
+	Phase     string  `json:"phase"` // list | filter | delete
+	Processed int     `json:"processed"`
+	Total     int     `json:"total"`
+	Percent   float64 `json:"percent"`
+}
+
+// 统计一个 phase 的进度, 并发安全. fn 为 nil 时不做任何事.
+type progressReporter struct {
+	mu        sync.Mutex
+	fn        func(Progress)
+	phase     string
+	total     int
+	processed int
+	reported  int       // 上一次回调时的 processed
+	last      time.Time // 上一次回调的时间
+
+	now func() time.Time // time.Now, 测试时可以替换
+}
+
+func newProgressReporter(fn func(Progress), phase string, total int) *progressReporter {
+	if fn == nil {
+		return nil
+	}
+
+	p := &progressReporter{fn: fn, phase: phase, total: total, now: time.Now}
+	p.report()
+	return p
+}
+
+// 完成了 n 个, 距离上一次回调超过 progressInterval 时回调.
+func (p *progressReporter) add(n int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.processed += n
+	if p.now().Sub(p.last) >= progressInterval {
+		p.report()
+	}
+}
+
+// phase 结束, 如果最后的进度还没有回调过则回调.
+// 出错或者 resource 在扫描过程中被删除时, processed 可能小于 total.
+func (p *progressReporter) done() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.processed != p.reported {
+		p.report()
+	}
+}
+
+// 调用者需要持有 p.mu, newProgressReporter 除外.
+func (p *progressReporter) report() {
+	percent := 100.0 // 没有需要处理的 resources
+	if p.total > 0 {
+		percent = float64(p.processed) * 100 / float64(p.total)
+	}
+
+	p.fn(Progress{Phase: p.phase, Processed: p.processed, Total: p.total, Percent: percent})
+	p.reported = p.processed
+	p.last = p.now()
+}
@@ -0,0 +1,61 @@
+package cleaner
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressReporter(t *testing.T) {
+	var events []Progress
+	p := newProgressReporter(func(pr Progress) { events = append(events, pr) }, "filter", 1000)
+	clock := p.last // 从第一次回调的时间开始, 只有手动前进
+	p.now = func() time.Time { return clock }
+
+	// 第一次回调在创建时.
+	if len(events) != 1 || events[0].Processed != 0 || events[0].Percent != 0 {
+		t.Fatalf("first events %+v", events)
+	}
+
+	// progressInterval 之内的 add 不回调, 即使是并发调用.
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.add(1)
+		}()
+	}
+	wg.Wait()
+	if len(events) != 1 {
+		t.Fatalf("got %d events within progressInterval, want 1", len(events))
+	}
+
+	// 超过 progressInterval 之后的第一次 add 回调一次.
+	clock = clock.Add(progressInterval)
+	p.add(1)
+	p.add(1)
+	if len(events) != 2 || events[1].Processed != 501 {
+		t.Fatalf("got %+v, want a second event at 501", events)
+	}
+
+	p.add(498)
+	p.done()
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	if last := events[2]; last != (Progress{Phase: "filter", Processed: 1000, Total: 1000, Percent: 100}) {
+		t.Errorf("last event %+v", last)
+	}
+
+	// 最后的进度已经回调过时, done 不再回调.
+	p.done()
+	if len(events) != 3 {
+		t.Errorf("got %d events after a second done, want 3", len(events))
+	}
+
+	// fn 为 nil 时不做任何事.
+	nop := newProgressReporter(nil, "delete", 1)
+	nop.add(1)
+	nop.done()
+}
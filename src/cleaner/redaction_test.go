@@ -0,0 +1,87 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// token 只通过 withToken() 添加, 不能出现在任何 log 和返回的 error 中.
+func TestTokenNotLogged(t *testing.T) {
+	const token = "0123456789secret0123456789"
+
+	var resources []Item
+	for i := 0; i < 3; i++ {
+		resources = append(resources, Item{ID: fmt.Sprintf("%032x", i)})
+	}
+	m, req := newMockJoplin(t, resources, nil)
+	m.mu.Lock()
+	m.token, req.Token = token, token
+	m.mu.Unlock()
+	req.Concurrency = 2
+
+	var logs strings.Builder
+	req.Logger = log.New(&logs, "", 0)
+
+	unused := make(map[string]Item)
+	for _, item := range resources {
+		unused[item.ID] = item
+	}
+
+	check := func(when string, fail func(w http.ResponseWriter, r *http.Request) bool) {
+		m.mu.Lock()
+		m.fail = fail
+		m.mu.Unlock()
+
+		if _, err := getAllResources(context.Background(), req); err == nil {
+			t.Errorf("%s: getAllResources should fail", when)
+		} else if strings.Contains(err.Error(), token) {
+			t.Errorf("%s: token in getAllResources error: %v", when, err)
+		}
+		if err := filterResources(context.Background(), req, maps.Clone(unused)); err == nil {
+			t.Errorf("%s: filterResources should fail", when)
+		} else if strings.Contains(err.Error(), token) {
+			t.Errorf("%s: token in filterResources error: %v", when, err)
+		}
+		_, failed, err := deleteResources(context.Background(), req, maps.Clone(unused), Options{KeepGoing: true, Reverify: true})
+		if len(failed) == 0 {
+			t.Errorf("%s: deleteResources should fail", when)
+		}
+		if err != nil && strings.Contains(err.Error(), token) {
+			t.Errorf("%s: token in deleteResources error: %v", when, err)
+		}
+		for _, f := range failed {
+			if strings.Contains(f.Error, token) || strings.Contains(f.Endpoint, token) {
+				t.Errorf("%s: token in delete failure %+v", when, f)
+			}
+		}
+	}
+
+	// listing 返回 500, reference check 断开连接, delete 返回 500.
+	check("server errors", func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasSuffix(r.URL.Path, "/notes") {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return true
+		}
+		writeMockError(w, http.StatusInternalServerError, "Internal Server Error")
+		return true
+	})
+
+	// 连接断开时 url.Error 包含完整的 URL.
+	check("connection closed", func(w http.ResponseWriter, r *http.Request) bool {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return true
+	})
+
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, token) {
+			t.Errorf("token in log: %s", line)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cleaner
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// a resource which has been deleted.
+type DeleteRecord struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Size        int64     `json:"size"`
+	Mime        string    `json:"mime"`
+	CreatedTime int64     `json:"created_time"` // unix ms
+	UpdatedTime int64     `json:"updated_time"` // unix ms
+	DeletedAt   time.Time `json:"deleted_at"`
+}
+
+// a resource which failed to delete.
+type DeleteFailure struct {
+	ID       string `json:"id"`
+	Status   int    `json:"status"`   // HTTP status, 0 means no response, eg: network error
+	Endpoint string `json:"endpoint"` // eg: "DELETE /resources/:id"
+	Cause    string `json:"cause"`    // see failureCause()
+	Error    string `json:"error"`
+}
+
+func newDeleteFailure(id, endpoint string, err error) DeleteFailure {
+	f := DeleteFailure{ID: id, Endpoint: endpoint, Error: err.Error()}
+
+	var ae *APIError
+	if errors.As(err, &ae) {
+		f.Status = ae.Status
+		f.Error = ae.Message
+	}
+	f.Cause = failureCause(f.Status)
+
+	return f
+}
+
+// 根据 HTTP status 对失败原因进行分类, 方便判断如何处理.
+func failureCause(status int) string {
+	switch {
+	case status == 0:
+		return "network error" // retry later
+	case status == http.StatusNotFound:
+		return "not found" // already gone, benign
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "unauthorized" // check token
+	case status >= http.StatusInternalServerError:
+		return "server error" // retry later
+	default:
+		return "other"
+	}
+}
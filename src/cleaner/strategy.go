@@ -0,0 +1,143 @@
+package cleaner
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// 遍历所有 notes 的 body, 返回 resource ID -> 链接该 resource 的 note IDs.
+// 请求数只和 notes 的页数有关, 不需要对每个 resource 查询 /resources/:id/notes.
+// 回收站中的 notes 不算引用, 和 filterResources() 一致.
+func bodyLinks(ctx context.Context, req Client) (map[string][]string, error) {
+	notes, err := getAllNotes(ctx, req, "id,body", false)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make(map[string][]string)
+	for _, n := range notes {
+		for _, m := range resourceLinkRe.FindAllStringSubmatch(n.Body, -1) {
+			links[m[1]] = append(links[m[1]], n.ID)
+		}
+	}
+	return links, nil
+}
+
+// notes-centric strategy: 将 note body 中链接的 resources 从 map 中删除.
+func filterResourcesByNotes(ctx context.Context, req Client, resources map[string]Item) error {
+	links, err := bodyLinks(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for id := range links {
+		delete(resources, id)
+	}
+	return nil
+}
+
+// -snapshot: 实现 referenceCheck, 一次读取所有 notes 得到完整的 resource -> notes 引用关系,
+// 和 resources 的 listing 一起组成一致的 snapshot, 不需要对每个 resource 单独查询,
+// 缩短了 listing 和 reference check 之间的 TOCTOU 窗口.
+func snapshotReferences(ctx context.Context, req Client, resources map[string]Item, onChecked func(id string, notes int)) error {
+	links, err := bodyLinks(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	var used []string
+	for id := range resources {
+		notes := len(links[id])
+		if notes > 0 {
+			used = append(used, id)
+		}
+		if onChecked != nil {
+			onChecked(id, notes)
+		}
+	}
+
+	for _, id := range used {
+		delete(resources, id)
+	}
+	req.logger().Printf("snapshot: note bodies link to %d resources, %d of them are listed\n", len(links), len(used))
+	return nil
+}
+
+// 最严格的 unused 定义: API 和 note body 都没有引用才删除, 即两种 strategy 的交集.
+// resources 是 API reference check 之后剩下的 unused resources, 被 API 引用的 resources 记录在 d 中.
+// 两种方法结果不一致的 resources 都会打印出来.
+func skipBodyLinkedResources(ctx context.Context, req Client, resources map[string]Item, d Decisions) error {
+	links, err := bodyLinks(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range SortedIDs(resources) {
+		if notes, ok := links[id]; ok {
+			req.logger().Printf("disagree %s: API reports no references, but linked from note %s\n", id, strings.Join(notes, ", "))
+			d.Keep(resources, id, "linked from note body, see -only-delete-zero-reference")
+		}
+	}
+
+	var apiOnly []string
+	for id, dc := range d {
+		if _, ok := links[id]; dc.Notes > 0 && !ok {
+			apiOnly = append(apiOnly, id)
+		}
+	}
+	sort.Strings(apiOnly)
+	for _, id := range apiOnly {
+		req.logger().Printf("disagree %s: referenced by %d notes according to API, but not linked from any note body\n", id, d[id].Notes)
+	}
+	return nil
+}
+
+// 两种 strategy 计算出的 unused resources 的差异.
+type StrategyDiff struct {
+	Scanned      int      `json:"scanned"`
+	Unused       int      `json:"unused"`        // 两种 strategy 都认为 unused
+	OnlyResource []string `json:"only_resource"` // 只有 per-resource strategy 认为 unused
+	OnlyNotes    []string `json:"only_notes"`    // 只有 notes-centric strategy 认为 unused
+}
+
+// 对同一份 resources 分别使用两种 strategy, 不删除任何 resource.
+func (req Client) CompareStrategies(ctx context.Context) (diff StrategyDiff, err error) {
+	resources, err := getAllResources(ctx, req)
+	if err != nil {
+		return diff, err
+	}
+	diff.Scanned = len(resources)
+
+	byResource := make(map[string]Item, len(resources))
+	byNotes := make(map[string]Item, len(resources))
+	for id, item := range resources {
+		byResource[id] = item
+		byNotes[id] = item
+	}
+
+	if err = filterResources(ctx, req, byResource); err != nil {
+		return diff, err
+	}
+	if err = filterResourcesByNotes(ctx, req, byNotes); err != nil {
+		return diff, err
+	}
+
+	diff.OnlyResource, diff.OnlyNotes = []string{}, []string{}
+	for id := range byResource {
+		if _, ok := byNotes[id]; ok {
+			diff.Unused++
+		} else {
+			diff.OnlyResource = append(diff.OnlyResource, id)
+		}
+	}
+	for id := range byNotes {
+		if _, ok := byResource[id]; !ok {
+			diff.OnlyNotes = append(diff.OnlyNotes, id)
+		}
+	}
+	sort.Strings(diff.OnlyResource)
+	sort.Strings(diff.OnlyNotes)
+
+	return diff, nil
+}
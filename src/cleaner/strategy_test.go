@@ -0,0 +1,67 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCompareStrategies(t *testing.T) {
+	id := func(i int) string { return fmt.Sprintf("%032x", i) }
+
+	var all []Item
+	for i := 0; i < 5; i++ {
+		all = append(all, Item{ID: id(i)})
+	}
+	// id(1): 两种 strategy 一致; id(2): 只有 /resources/:id/notes 有引用; id(3): 只有 note body 有链接.
+	m, req := newMockJoplin(t, all, map[string][]string{id(1): {"n1"}, id(2): {"n2"}})
+	m.notes = []Item{
+		{ID: "n1", Body: "![](:/" + id(1) + ")"},
+		{ID: "n3", Body: "[a.pdf](:/" + id(3) + ")"},
+	}
+
+	diff, err := req.CompareStrategies(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := StrategyDiff{Scanned: 5, Unused: 2, OnlyResource: []string{id(3)}, OnlyNotes: []string{id(2)}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("got %+v, want %+v", diff, want)
+	}
+}
+
+func TestSkipBodyLinkedResources(t *testing.T) {
+	id := func(i int) string { return fmt.Sprintf("%032x", i) }
+
+	var all []Item
+	for i := 0; i < 3; i++ {
+		all = append(all, Item{ID: id(i)})
+	}
+	m, req := newMockJoplin(t, all, map[string][]string{id(0): {"n0"}})
+	m.notes = []Item{{ID: "n1", Body: "![](:/" + id(1) + ")"}}
+
+	resources := make(map[string]Item)
+	for _, item := range all {
+		resources[item.ID] = item
+	}
+	d := make(Decisions)
+	if err := scanResources(context.Background(), req, resources, d, filterResourcesNotify, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := skipBodyLinkedResources(context.Background(), req, resources, d); err != nil {
+		t.Fatal(err)
+	}
+
+	// id(0) 被 API 引用, id(1) 被 note body 链接, 只有 id(2) 两种方法都没有引用.
+	if len(resources) != 1 {
+		t.Fatalf("got %d unused, want 1", len(resources))
+	}
+	if _, ok := resources[id(2)]; !ok {
+		t.Errorf("%s should be unused", id(2))
+	}
+	if !d[id(1)].Keep {
+		t.Errorf("%s should be kept", id(1))
+	}
+}
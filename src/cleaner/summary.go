@@ -0,0 +1,49 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// end-of-run summary, text 和 json 输出使用同一份数据.
+type Summary struct {
+	Scanned int   `json:"scanned"`
+	Unused  int   `json:"unused"`
+	Deleted int   `json:"deleted"`
+	Failed  int   `json:"failed"`
+	Freed   int64 `json:"freed_bytes"`
+
+	Phases PhaseTimes `json:"phases"`
+}
+
+// 每个 phase 的耗时, 没有执行的 phase 为 0.
+type PhaseTimes struct {
+	List   time.Duration
+	Filter time.Duration
+	Delete time.Duration
+}
+
+// json 中使用 milliseconds.
+func (p PhaseTimes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		List   int64 `json:"listing_ms"`
+		Filter int64 `json:"filtering_ms"`
+		Delete int64 `json:"deleting_ms"`
+	}{p.List.Milliseconds(), p.Filter.Milliseconds(), p.Delete.Milliseconds()})
+}
+
+// 1536 -> "1.5KiB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,301 @@
+package cleaner
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 一个 middleware 包装一个 http.RoundTripper, 只处理一个 cross-cutting concern,
+// 例如 token, retry, dump. 所有请求都通过 Client.httpClient() 发出.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// mws[0] 在最外层, 最先处理 request, 最后处理 response.
+func chain(rt http.RoundTripper, mws ...Middleware) http.RoundTripper {
+	for i := len(mws) - 1; i >= 0; i-- {
+		rt = mws[i](rt)
+	}
+	return rt
+}
+
+// 所有 clients 共用, reuses connections.
+var baseTransport http.RoundTripper = http.DefaultTransport.(*http.Transport).Clone()
+
+// 默认的 middlewares, extra 在 token 之外, 看不到 token.
+//
+//	redact -> extra... -> retry -> token -> baseTransport
+func NewHTTPClient(token string, extra ...Middleware) *http.Client {
+	mws := []Middleware{withRedaction(token)}
+	mws = append(mws, extra...)
+	mws = append(mws, withRetry(retryAttempts, retryBackoff), withToken(token))
+
+	return &http.Client{
+		Timeout:   3 * time.Second,
+		Transport: chain(baseTransport, mws...),
+	}
+}
+
+var (
+	defaultClientsMu sync.Mutex
+	defaultClients   = make(map[string]*http.Client) // token -> client
+)
+
+// Client.HTTPClient 为 nil 时 (eg: tests) 使用默认的 middlewares.
+func (req Client) httpClient() *http.Client {
+	if req.HTTPClient != nil {
+		return req.HTTPClient
+	}
+
+	defaultClientsMu.Lock()
+	defer defaultClientsMu.Unlock()
+	c, ok := defaultClients[req.Token]
+	if !ok {
+		c = NewHTTPClient(req.Token)
+		defaultClients[req.Token] = c
+	}
+	return c
+}
+
+// 下载 resource 文件使用, 和 httpClient() 的 middlewares 相同, 但是没有总的 Timeout,
+// 大文件可能需要很长时间. 由 request 的 context 限制, eg: -delete-timeout.
+func (req Client) downloadClient() *http.Client {
+	c := *req.httpClient()
+	c.Timeout = 0
+	return &c
+}
+
+// joplin 的 token 只能通过 query 传递. URLs 中不包含 token,
+// 所以 url.Error 和 APIError 中都不会出现 token.
+func withToken(token string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if token == "" {
+				return next.RoundTrip(r)
+			}
+
+			// RoundTripper 不能修改原来的 request.
+			r = r.Clone(r.Context())
+			q := r.URL.Query()
+			q.Set("token", token)
+			r.URL.RawQuery = q.Encode()
+			return next.RoundTrip(r)
+		})
+	}
+}
+
+const (
+	retryAttempts = 3
+	retryBackoff  = 200 * time.Millisecond
+)
+
+// 只重试 GET: 网络错误和 502 / 503 / 504. DELETE 成功之后重试会返回 404, 所以不重试.
+func withRetry(attempts int, backoff time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Method != http.MethodGet {
+				return next.RoundTrip(r)
+			}
+
+			for i := 1; ; i++ {
+				resp, err := next.RoundTrip(r)
+				if i >= attempts || !retryable(resp, err) || r.Context().Err() != nil {
+					return resp, err
+				}
+				if resp != nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+
+				select {
+				case <-r.Context().Done():
+					return nil, r.Context().Err()
+				case <-time.After(backoff * time.Duration(i)):
+				}
+			}
+		})
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// 打印每个请求的 method, path, status 和耗时. 在 withToken 之外, 所以看不到 token.
+func WithDump(w io.Writer) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(r)
+			if err != nil {
+				fmt.Fprintf(w, "http: %s %s: %v (%s)\n", r.Method, r.URL.RequestURI(), err, time.Since(start).Round(time.Millisecond))
+				return resp, err
+			}
+			fmt.Fprintf(w, "http: %s %s: %d (%s)\n", r.Method, r.URL.RequestURI(), resp.StatusCode, time.Since(start).Round(time.Millisecond))
+			return resp, err
+		})
+	}
+}
+
+// 每秒最多发出 perSecond 个请求, 所有 hosts 共用. 请求之间至少间隔 1s / perSecond, 没有 burst.
+// 等待期间 request 的 context 结束时返回 context 的 error.
+func WithRateLimit(perSecond int) Middleware {
+	interval := time.Second / time.Duration(perSecond)
+	var (
+		mu   sync.Mutex
+		slot time.Time // 下一个请求最早可以发出的时间
+	)
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			at := time.Now()
+			if slot.After(at) {
+				at = slot
+			}
+			slot = at.Add(interval)
+			mu.Unlock()
+
+			if wait := time.Until(at); wait > 0 {
+				timer := time.NewTimer(wait)
+				defer timer.Stop()
+				select {
+				case <-r.Context().Done():
+					return nil, r.Context().Err()
+				case <-timer.C:
+				}
+			}
+			return next.RoundTrip(r)
+		})
+	}
+}
+
+// 以防万一, 把 error 中的 token 替换掉. 应该在最外层.
+func withRedaction(token string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(r)
+			if err != nil && token != "" && strings.Contains(err.Error(), token) {
+				err = &redactedError{msg: strings.ReplaceAll(err.Error(), token, "REDACTED"), err: err}
+			}
+			return resp, err
+		})
+	}
+}
+
+// 保留原来的 error, errors.Is() 仍然可以判断 timeout 等错误.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// 限制每个 host 同时进行的请求数. 同一个 host 的请求可能来自不同的 worker pools
+// (eg: scanResources() 中的 reference check 和 metadata enrichment), 所以需要在 transport 中限制.
+type HostLimiter struct {
+	limit int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	sem      chan struct{}
+	inFlight int
+	peak     int // 最大同时进行的请求数
+}
+
+func NewHostLimiter(limit int) *HostLimiter {
+	return &HostLimiter{limit: limit, hosts: make(map[string]*hostSlots)}
+}
+
+func (l *HostLimiter) slots(host string) *hostSlots {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.hosts[host]
+	if !ok {
+		s = &hostSlots{sem: make(chan struct{}, l.limit)}
+		l.hosts[host] = s
+	}
+	return s
+}
+
+// 请求在 response body 被关闭之后才释放.
+func (l *HostLimiter) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			s := l.slots(r.URL.Host)
+			select {
+			case s.sem <- struct{}{}:
+			case <-r.Context().Done():
+				return nil, r.Context().Err()
+			}
+
+			l.mu.Lock()
+			s.inFlight++
+			s.peak = max(s.peak, s.inFlight)
+			l.mu.Unlock()
+
+			var once sync.Once
+			release := func() {
+				once.Do(func() {
+					l.mu.Lock()
+					s.inFlight--
+					l.mu.Unlock()
+					<-s.sem
+				})
+			}
+
+			resp, err := next.RoundTrip(r)
+			if err != nil {
+				release()
+				return resp, err
+			}
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+			return resp, nil
+		})
+	}
+}
+
+// 每个 host 实际达到的最大并发数, eg: "localhost:41184: 4/4".
+func (l *HostLimiter) Report(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hosts := make([]string, 0, len(l.hosts))
+	for h := range l.hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		fmt.Fprintf(w, "%s: peak concurrency %d, limit %d\n", h, l.hosts[h].peak, l.limit)
+	}
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
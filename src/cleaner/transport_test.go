@@ -0,0 +1,182 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(r)
+			})
+		}
+	}
+	base := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		order = append(order, "base")
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+
+	r, _ := http.NewRequest("GET", "http://localhost/ping", http.NoBody)
+	if _, err := chain(base, mw("a"), mw("b")).RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, ","); got != "a,b,base" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestWithToken(t *testing.T) {
+	var got string
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		got = r.URL.Query().Get("token")
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+
+	r, _ := http.NewRequest("GET", "http://localhost/resources?fields=id", http.NoBody)
+	if _, err := withToken("secret")(base).RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+	if got != "secret" {
+		t.Errorf("token %q, want secret", got)
+	}
+	if r.URL.Query().Has("token") {
+		t.Error("original request is modified")
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		fails  int // 前几次返回 503
+		want   int // 请求次数
+		status int
+	}{
+		{method: "GET", fails: 1, want: 2, status: http.StatusOK},
+		{method: "GET", fails: 5, want: 3, status: http.StatusServiceUnavailable},
+		{method: "DELETE", fails: 1, want: 1, status: http.StatusServiceUnavailable},
+	} {
+		var n int
+		base := roundTripFunc(func(*http.Request) (*http.Response, error) {
+			n++
+			if n <= tc.fails {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})
+
+		r, _ := http.NewRequest(tc.method, "http://localhost/resources", http.NoBody)
+		resp, err := withRetry(3, time.Millisecond)(base).RoundTrip(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tc.want || resp.StatusCode != tc.status {
+			t.Errorf("%s with %d failures: %d requests, status %d, want %d, %d", tc.method, tc.fails, n, resp.StatusCode, tc.want, tc.status)
+		}
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	var n int
+	base := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		n++
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	rt := WithRateLimit(100)(base)
+
+	// 第一个请求立即发出, 之后每个请求间隔 10ms.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		r, _ := http.NewRequest("GET", "http://localhost/resources", http.NoBody)
+		if _, err := rt.RoundTrip(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 requests took %s, want at least 40ms", elapsed)
+	}
+
+	// 等待期间 context 结束, 请求不会发出.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, _ := http.NewRequestWithContext(ctx, "GET", "http://localhost/resources", http.NoBody)
+	if _, err := rt.RoundTrip(r); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if n != 5 {
+		t.Errorf("got %d requests, want 5", n)
+	}
+}
+
+func TestWithRedaction(t *testing.T) {
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.Join(errors.New("GET "+r.URL.String()), context.DeadlineExceeded)
+	})
+
+	r, _ := http.NewRequest("GET", "http://localhost/resources?token=secret", http.NoBody)
+	_, err := withRedaction("secret")(base).RoundTrip(r)
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("token in error: %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lost wrapped error: %v", err)
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		inFlight int
+		peak     int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	l := NewHostLimiter(3)
+	c := &http.Client{Transport: chain(baseTransport, l.Middleware())}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Get(ts.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if peak > 3 {
+		t.Errorf("server saw %d concurrent requests, limit 3", peak)
+	}
+
+	var b strings.Builder
+	l.Report(&b)
+	if !strings.Contains(b.String(), "limit 3") {
+		t.Errorf("report: %q", b.String())
+	}
+}
@@ -0,0 +1,57 @@
+package cleaner
+
+import (
+	"context"
+	"time"
+)
+
+// a trashed note linking to an unused resource.
+type TrashedNote struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	DeletedTime time.Time `json:"deleted_time"`
+}
+
+// unused resource 以及链接到它的回收站中的 notes, 用于了解 unused resource 的来源.
+type OrphanProvenance struct {
+	ID           string        `json:"id"`
+	Title        string        `json:"title"`
+	Size         int64         `json:"size"`
+	TrashedNotes []TrashedNote `json:"trashed_notes"`
+}
+
+// 回收站中的 notes 不算引用 (见 bodyLinks()), 但是通常就是 unused resources 的来源.
+// 通过 note body 中的链接把 unused resources 和回收站中的 notes 关联起来, 按 resource ID 排序.
+func (req Client) TrashProvenance(ctx context.Context, unused map[string]Item) ([]OrphanProvenance, error) {
+	orphans := []OrphanProvenance{}
+	if len(unused) < 1 {
+		return orphans, nil
+	}
+
+	notes, err := getAllNotes(ctx, req, "id,title,body,deleted_time", true)
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := make(map[string][]TrashedNote) // resource ID -> trashed notes
+	for _, n := range notes {
+		if n.DeletedTime == 0 {
+			continue
+		}
+		for _, m := range resourceLinkRe.FindAllStringSubmatch(n.Body, -1) {
+			if _, ok := unused[m[1]]; ok {
+				trashed[m[1]] = append(trashed[m[1]], TrashedNote{ID: n.ID, Title: n.Title, DeletedTime: time.UnixMilli(n.DeletedTime)})
+			}
+		}
+	}
+
+	for _, id := range SortedIDs(unused) {
+		item := unused[id]
+		o := OrphanProvenance{ID: id, Title: item.Title, Size: item.Size, TrashedNotes: trashed[id]}
+		if o.TrashedNotes == nil {
+			o.TrashedNotes = []TrashedNote{}
+		}
+		orphans = append(orphans, o)
+	}
+	return orphans, nil
+}
@@ -0,0 +1,45 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestTrashProvenance(t *testing.T) {
+	id := func(i int) string { return fmt.Sprintf("%032x", i) }
+
+	m, req := newMockJoplin(t, nil, nil)
+	m.notes = []Item{
+		{ID: "n1", Title: "live", Body: "![](:/" + id(0) + ")"},
+		{ID: "n2", Title: "trashed", Body: "![](:/" + id(0) + ") [a.pdf](:/" + id(1) + ")", DeletedTime: 1000},
+		{ID: "n3", Title: "also trashed", Body: "[a.pdf](:/" + id(1) + ")", DeletedTime: 2000},
+	}
+
+	unused := map[string]Item{
+		id(0): {ID: id(0)},
+		id(1): {ID: id(1)},
+		id(2): {ID: id(2)},
+	}
+	orphans, err := req.TrashProvenance(context.Background(), unused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 3 {
+		t.Fatalf("got %d orphans, want 3", len(orphans))
+	}
+
+	// 只有回收站中的 notes 会被关联.
+	for i, want := range []string{"trashed", "trashed,also trashed", ""} {
+		var got string
+		for j, n := range orphans[i].TrashedNotes {
+			if j > 0 {
+				got += ","
+			}
+			got += n.Title
+		}
+		if got != want {
+			t.Errorf("%s: got trashed notes %q, want %q", orphans[i].ID, got, want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package cleaner
+
+import (
+	"context"
+)
+
+// getAllResources() + filterResources(). metadata 为 true 时同时获取 metadata, 见 scanResources().
+func (req Client) FindUnused(ctx context.Context, metadata bool) (map[string]Item, error) {
+	resources, err := getAllResources(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata {
+		err = scanResources(ctx, req, resources, make(Decisions), filterResourcesNotify, nil)
+	} else {
+		err = filterResources(ctx, req, resources)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
@@ -0,0 +1,46 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestFindUnused(t *testing.T) {
+	var all []Item
+	refs := make(map[string][]string)
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("%032x", i)
+		all = append(all, Item{ID: id, Title: "title " + id, Size: int64(i)})
+		if i%2 == 0 {
+			refs[id] = []string{"note"}
+		}
+	}
+	m, req := newMockJoplin(t, all, refs)
+
+	for _, metadata := range []bool{false, true} {
+		m.mu.Lock()
+		m.gets = 0
+		m.mu.Unlock()
+
+		unused, err := req.FindUnused(context.Background(), metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, item := range all {
+			_, used := refs[item.ID]
+			if _, ok := unused[item.ID]; ok == used {
+				t.Errorf("metadata %v: %s used %v, got unused %v", metadata, item.ID, used, ok)
+			}
+		}
+
+		// 不需要 metadata 时不请求 GET /resources/:id.
+		if fetched := m.gets > 0; fetched != metadata {
+			t.Errorf("metadata %v: %d metadata fetches", metadata, m.gets)
+		}
+		if metadata && unused[all[1].ID].Title != "title "+all[1].ID {
+			t.Errorf("missing metadata, got %+v", unused[all[1].ID])
+		}
+	}
+}
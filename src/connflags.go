@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"local/src/cleaner"
+)
+
+// 连接 joplin 的 flags, main 和 subcommands 共用, 见 connectionFlags().
+type connFlags struct {
+	fs          *flag.FlagSet
+	port        *int
+	token       *string
+	profileDir  *string
+	concurrency *int
+	perHost     *int
+	rateLimit   *int
+	debugHTTP   *bool
+}
+
+// 在 fs 中定义连接 joplin 的 flags, fs.Parse() 之后调用 newClient().
+func connectionFlags(fs *flag.FlagSet) *connFlags {
+	return &connFlags{
+		fs:          fs,
+		port:        fs.Int("p", 41184, "joplin Web Clipper service port"),
+		token:       fs.String("t", "", "joplin Web Clipper Authorization token"),
+		profileDir:  fs.String("joplin-profile", "", "read the token and port from this Joplin desktop profile directory, eg: ~/.config/joplin-desktop. -t and -p take precedence"),
+		concurrency: fs.Int("concurrency", 0, "max concurrent requests, 0 means probe the server latency and pick a default"),
+		perHost:     fs.Int("concurrency-per-host", 0, "max in-flight requests to one joplin instance across all worker pools, 0 means unlimited"),
+		rateLimit:   fs.Int("rate-limit", 0, "max requests per second to joplin, 0 means unlimited. waiting counts toward the request timeout, keep -concurrency at or below it"),
+		debugHTTP:   fs.Bool("debug-http", false, "print every request to stderr, the token is not printed"),
+	}
+}
+
+// 读取 -joplin-profile, 检查 flags, 返回带有 http client 的 cleaner.Client.
+// 返回的 report 打印 -concurrency-per-host 的统计, 退出之前调用.
+func (c *connFlags) newClient() (req cleaner.Client, report func(), err error) {
+	if *c.profileDir != "" {
+		settings, err := readProfileSettings(*c.profileDir)
+		if err != nil {
+			return cleaner.Client{}, nil, err
+		}
+
+		// 命令行中指定的 -t / -p 优先.
+		explicit := make(map[string]bool)
+		c.fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if !explicit["t"] {
+			*c.token = settings.Token
+		}
+		if !explicit["p"] && settings.Port != 0 {
+			*c.port = settings.Port
+		}
+	}
+
+	if *c.token == "" {
+		return cleaner.Client{}, nil, errors.New("token is empty")
+	}
+
+	if *c.port > 65535 || *c.port < 0 {
+		return cleaner.Client{}, nil, errors.New("port is invalid")
+	}
+
+	if *c.concurrency < 0 {
+		return cleaner.Client{}, nil, errors.New("concurrency is invalid")
+	}
+
+	if *c.perHost < 0 {
+		return cleaner.Client{}, nil, errors.New("concurrency-per-host is invalid")
+	}
+
+	if *c.rateLimit < 0 {
+		return cleaner.Client{}, nil, errors.New("rate-limit is invalid")
+	}
+
+	req = cleaner.Client{Port: *c.port, Token: *c.token, Concurrency: *c.concurrency, Logger: log.Default()}
+	report = func() {}
+
+	var mws []cleaner.Middleware
+	if *c.perHost > 0 {
+		limiter := cleaner.NewHostLimiter(*c.perHost)
+		mws = append(mws, limiter.Middleware())
+		report = func() { limiter.Report(os.Stderr) }
+	}
+	if *c.rateLimit > 0 {
+		mws = append(mws, cleaner.WithRateLimit(*c.rateLimit))
+	}
+	if *c.debugHTTP {
+		mws = append(mws, cleaner.WithDump(os.Stderr))
+	}
+	req.HTTPClient = cleaner.NewHTTPClient(req.Token, mws...)
+
+	return req, report, nil
+}
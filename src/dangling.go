@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"local/src/cleaner"
+)
+
+func printDanglingNotes(w io.Writer, dangling []cleaner.DanglingNote) {
+	if len(dangling) < 1 {
+		fmt.Fprintln(w, "no notes link to the deleted attachments")
+		return
+	}
+
+	fmt.Fprintf(w, "%d notes link to deleted attachments:\n", len(dangling))
+	for _, n := range dangling {
+		fmt.Fprintf(w, "  %s %q\n", n.ID, n.Title)
+		for _, id := range n.ResourceIDs {
+			fmt.Fprintf(w, "    - :/%s\n", id)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"local/src/cleaner"
+)
+
+// Graphviz DOT, note -> resource. 同一个 note 只定义一次.
+//
+//	dot -Tsvg graph.dot > graph.svg
+func printGraphDOT(w io.Writer, nodes []cleaner.GraphNode) {
+	fmt.Fprintln(w, "digraph joplin {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+
+	notes := make(map[string]bool)
+	for _, n := range nodes {
+		fmt.Fprintf(w, "  %s [label=%s, shape=ellipse];\n", strconv.Quote(n.ID), strconv.Quote(n.Title))
+		for _, note := range n.Notes {
+			if !notes[note.ID] {
+				notes[note.ID] = true
+				fmt.Fprintf(w, "  %s [label=%s, shape=box];\n", strconv.Quote(note.ID), strconv.Quote(note.Title))
+			}
+			fmt.Fprintf(w, "  %s -> %s;\n", strconv.Quote(note.ID), strconv.Quote(n.ID))
+		}
+	}
+
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"local/src/cleaner"
+)
+
+func TestPrintGraphDOT(t *testing.T) {
+	nodes := []cleaner.GraphNode{
+		{ID: "r0", Title: "a.png", Notes: []cleaner.Item{{ID: "n1", Title: "note 1"}, {ID: "n2", Title: "note 2"}}},
+		{ID: "r1", Title: "b.pdf"},
+	}
+
+	var b strings.Builder
+	printGraphDOT(&b, nodes)
+	for _, want := range []string{
+		`"n1" -> "r0";`,
+		`"n2" -> "r0";`,
+		`"n1" [label="note 1", shape=box];`,
+		`"r1" [label="b.pdf", shape=ellipse];`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("DOT missing %s:\n%s", want, b.String())
+		}
+	}
+}
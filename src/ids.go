@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Joplin item ID: 32 个小写 hex 字符.
+var resourceIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// 从 Joplin 中复制出来的 ID 可能有以下格式, 都转换成 bare ID:
+//
+//	0123456789abcdef0123456789abcdef
+//	:/0123456789abcdef0123456789abcdef
+//	![image.png](:/0123456789abcdef0123456789abcdef)
+//	joplin://x-callback-url/openItem?id=0123456789abcdef0123456789abcdef
+//	http://localhost:41184/resources/0123456789abcdef0123456789abcdef/file?token=...
+func parseResourceID(s string) (string, error) {
+	raw := s
+	s = strings.TrimSpace(s)
+
+	// markdown link / image
+	if strings.HasSuffix(s, ")") {
+		if i := strings.LastIndex(s, "]("); i >= 0 {
+			s = s[i+2 : len(s)-1]
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(s, ":/"):
+		s = s[2:]
+	case strings.Contains(s, "://"):
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid resource ID %q: %w", raw, err)
+		}
+		s = u.Query().Get("id")
+		if s == "" {
+			// REST API URL: /resources/:id[/file]
+			parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+			for i := 0; i < len(parts)-1; i++ {
+				if parts[i] == "resources" {
+					s = parts[i+1]
+					break
+				}
+			}
+		}
+	}
+
+	s = strings.ToLower(s)
+	if !resourceIDRe.MatchString(s) {
+		return "", fmt.Errorf("invalid resource ID %q, want 32 hex characters", raw)
+	}
+	return s, nil
+}
+
+// 逗号分隔的 IDs, eg: -only-ids
+func parseResourceIDList(s string) ([]string, error) {
+	var ids []string
+	for i, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		id, err := parseResourceID(field)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) < 1 {
+		return nil, errors.New("no resource IDs")
+	}
+	return ids, nil
+}
+
+// 读取 ID 列表文件, 根据扩展名判断格式, 可以直接使用本工具输出的 reports:
+//   - .csv: 第一列, 或者 header 中名为 "id" 的列
+//   - .json: ["<id>", ...], [{"id": "<id>"}, ...] (eg: -delete-report, -export-graph),
+//     或者 {"unused_ids": [...]} (eg: -format json)
+//   - 其他: 每行一个 ID, 忽略空行和 "#" 开头的注释. 也可以是 -delete-report 的 text 格式, 只使用第一列.
+func readResourceIDFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readCSVIDs(path, f)
+	case ".json", ".jsonl":
+		return readJSONIDs(path, f)
+	}
+	return readPlainIDs(path, f)
+}
+
+func readPlainIDs(path string, r io.Reader) ([]string, error) {
+	var ids []string
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// text 格式的 report 有 header, 第一列是 ID. 追加写入的 report 每次运行都有一个 header.
+		fields := strings.Fields(text)
+		if strings.EqualFold(fields[0], "id") {
+			continue
+		}
+
+		id, err := parseResourceID(text)
+		if err != nil && len(fields) > 1 {
+			id, err = parseResourceID(fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, sc.Err()
+}
+
+func readCSVIDs(path string, r io.Reader) ([]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+
+	var ids []string
+	col := 0
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		// header
+		if first {
+			if i := slices.IndexFunc(record, func(s string) bool { return strings.EqualFold(strings.TrimSpace(s), "id") }); i >= 0 {
+				col = i
+				continue
+			}
+		}
+
+		if col >= len(record) || strings.TrimSpace(record[col]) == "" {
+			return nil, fmt.Errorf("%s:%d: missing ID in column %d", path, line, col+1)
+		}
+		id, err := parseResourceID(record[col])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func readJSONIDs(path string, r io.Reader) ([]string, error) {
+	var list []any
+	dec := json.NewDecoder(r)
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		switch e := v.(type) {
+		case []any:
+			list = append(list, e...)
+		case map[string]any:
+			// {"unused_ids": [...]}
+			if ids, ok := e["unused_ids"].([]any); ok {
+				list = append(list, ids...)
+				continue
+			}
+			// JSON lines, eg: -format json 的 -delete-report, 每行一个 {"id": ...}
+			if _, ok := e["id"]; ok {
+				list = append(list, e)
+				continue
+			}
+			return nil, errJSONIDs(path)
+		default:
+			return nil, errJSONIDs(path)
+		}
+	}
+
+	var ids []string
+	for i, e := range list {
+		var s string
+		switch e := e.(type) {
+		case string:
+			s = e
+		case map[string]any:
+			s, _ = e["id"].(string)
+		}
+
+		id, err := parseResourceID(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %w", path, i+1, err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func errJSONIDs(path string) error {
+	return fmt.Errorf("%s: want an array of IDs, an array of objects with \"id\", JSON lines of objects with \"id\", or an object with \"unused_ids\"", path)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"local/src/cleaner"
+)
+
+func TestParseResourceID(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef"
+	for _, s := range []string{
+		id,
+		"  " + id + "\t",
+		strings.ToUpper(id),
+		":/" + id,
+		"![image.png](:/" + id + ")",
+		"[a.pdf](:/" + id + ")",
+		"joplin://x-callback-url/openItem?id=" + id,
+		"http://localhost:41184/resources/" + id + "/file?token=abc",
+		"http://localhost:41184/resources/" + id,
+	} {
+		got, err := parseResourceID(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if got != id {
+			t.Errorf("%q: got %q", s, got)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		id[:31],
+		id + "0",
+		":/" + id[:31] + "g",
+		"http://localhost:41184/notes",
+		"joplin://x-callback-url/openItem?id=abc",
+	} {
+		if got, err := parseResourceID(s); err == nil {
+			t.Errorf("%q: got %q, want error", s, got)
+		}
+	}
+}
+
+func TestReadResourceIDFile(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef"
+	path := filepath.Join(t.TempDir(), "keep.txt")
+
+	content := "# keep these\n\n:/" + id + "\n" + id + "\nnot-an-id\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := readResourceIDFile(path)
+	if err == nil || !strings.Contains(err.Error(), path+":5:") {
+		t.Fatalf("got %v, want error on line 5", err)
+	}
+
+	if err = os.WriteFile(path, []byte(content[:strings.Index(content, "not-an-id")]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := readResourceIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != id || ids[1] != id {
+		t.Errorf("got %q", ids)
+	}
+}
+
+func TestReadResourceIDFileFormats(t *testing.T) {
+	const (
+		id1 = "0123456789abcdef0123456789abcdef"
+		id2 = "fedcba9876543210fedcba9876543210"
+	)
+	dir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"ids.txt":        id1 + "\n:/" + id2 + "\n",
+		"report.txt":     "ID  TITLE  SIZE\n" + id1 + "  a.png  10\n" + id2 + "  b.pdf  20\n",
+		"appended.txt":   "ID  TITLE  SIZE\n" + id1 + "  a.png  10\n\nID  TITLE  SIZE\n" + id2 + "  b.pdf  20\n\n",
+		"ids.csv":        id1 + "\n" + id2 + "\n",
+		"header.csv":     "title,id\na.png," + id1 + "\nb.pdf,:/" + id2 + "\n",
+		"strings.json":   `["` + id1 + `", ":/` + id2 + `"]`,
+		"report.json":    `[{"id": "` + id1 + `", "title": "a.png"}, {"id": "` + id2 + `"}]`,
+		"summary.json":   `{"unused_ids": ["` + id1 + `", "` + id2 + `"], "summary": {}}`,
+		"lines.json":     `{"id": "` + id1 + `", "title": "a.png"}` + "\n" + `{"id": "` + id2 + `"}` + "\n",
+		"lines.jsonl":    `{"id": "` + id1 + `"}` + "\n" + `{"id": "` + id2 + `"}` + "\n",
+		"UPPERCASE.JSON": `["` + id1 + `", "` + id2 + `"]`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		ids, err := readResourceIDFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(ids) != 2 || ids[0] != id1 || ids[1] != id2 {
+			t.Errorf("%s: got %q", name, ids)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"bad.csv":  "id\n" + id1 + "\nnot-an-id\n",
+		"bad.json": `{"ids": []}`,
+		"obj.json": `[{"title": "a.png"}]`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if ids, err := readResourceIDFile(path); err == nil {
+			t.Errorf("%s: got %q, want error", name, ids)
+		}
+	}
+}
+
+// -watch 的每次运行都追加到 -delete-report, 所有运行删除的 IDs 都可以作为 -keep-file 读取.
+func TestDeleteReportAppend(t *testing.T) {
+	const (
+		id1 = "0123456789abcdef0123456789abcdef"
+		id2 = "fedcba9876543210fedcba9876543210"
+	)
+	dir := t.TempDir()
+
+	for _, format := range []string{"text", "json"} {
+		path := filepath.Join(dir, "report."+format)
+		for _, id := range []string{id1, id2} {
+			if err := writeDeleteReport(path, format, false, []cleaner.DeleteRecord{{ID: id, Title: "a b.png"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ids, err := readResourceIDFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if len(ids) != 2 || ids[0] != id1 || ids[1] != id2 {
+			t.Errorf("%s: got %q", format, ids)
+		}
+	}
+}
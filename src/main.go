@@ -1,212 +1,620 @@
-// DOC:
-// https://joplinapp.org/api/references/rest_api/
-// https://joplinapp.org/api/references/rest_api/#resources
-
 package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
+
+	"local/src/cleaner"
 )
 
-type Item struct {
-	ID string `json:"id"` // resource ID / note ID
-}
+// -conservative 时只删除 30 天内没有更新过的 resources.
+const conservativeAge = 30 * 24 * time.Hour
 
-// response need to be parsed
-type joplinResponse struct {
-	Error string `json:"error"`
-	Items []Item `json:"items"`
-	More  bool   `json:"has_more"`
-}
+const (
+	msgNoUnused = "no unused attachments"
+	msgViewTip  = "view these attachments in 'Tools > Note attachments'"
+
+	msgNonInteractive = "stdin or stdout is not a terminal, not deleting without confirmation. use -yes (or -force) to delete non-interactively"
 
-type Req struct {
-	port  int    // joplin Web Clipper service port
-	token string // joplin token
+	// Joplin REST API 没有触发同步的 endpoint, 只能提醒用户手动同步.
+	msgSyncTip = "deletions reach other devices after the next sync, run 'Synchronise' in Joplin to propagate them now"
+)
+
+// 没有 terminal 并且没有 -yes / -force 时, 拒绝删除的 exit code, 让 cron 等可以发现配置错误.
+// 1 是其他错误, 2 是 flag 解析错误.
+const exitNotConfirmed = 3
+
+// run() 因为没有 terminal 而拒绝删除, 扫描和输出都已经完成.
+var errNotConfirmed = errors.New(msgNonInteractive)
+
+// command line options
+type options struct {
+	cleaner.Options
+
+	format       string        // text | json
+	quiet        bool          // don't print summary
+	pretty       bool          // pretty summary box
+	yes          bool          // delete without prompt
+	idsOnly      bool          // print unused IDs only, never delete
+	deleteReport string        // file to record deleted resources
+	emitScript   string        // write a delete script instead of deleting, "-" means stdout
+	verbose      bool          // print why each resource is kept or deleted
+	watch        time.Duration // re-scan interval, 0 means run once
+	syncAfter    bool          // remind to sync after deleting
+	humanize     bool          // friendly sizes and times in text reports
+	review       bool          // review and select unused resources before deleting, see reviewResources()
+	decisionLog  string        // write one JSON line per scanned resource to this file, see writeDecisionLog()
 }
 
-func readRespBody(method, url string, v any) error {
-	client := http.Client{
-		Timeout: 3 * time.Second,
+// 打印扫描结果: 每个 resource 的处理结果, 以及 unused resources 列表.
+func printScanned(msgOut io.Writer, report *cleaner.Report, opt options) {
+	if opt.verbose {
+		fmt.Fprintf(os.Stderr, "retrieved %d attachments from joplin\n", report.Summary.Scanned)
 	}
+	report.Decisions.Print(os.Stderr, opt.verbose)
 
-	req, err := http.NewRequest(method, url, http.NoBody)
-	if err != nil {
-		return err
+	// 所有模式的 empty case 都在这里提示, 之后不会 prompt, 也不会报错.
+	if len(report.Unused) < 1 {
+		fmt.Fprintln(msgOut, msgNoUnused)
+		return
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	// -export-ids-only / -emit-script 不打印列表.
+	if opt.idsOnly || opt.emitScript != "" {
+		return
 	}
-	defer resp.Body.Close()
 
-	err = json.NewDecoder(resp.Body).Decode(v)
-	// resp.Body 为空的时候, Unmarshal() 会报 EOF. Delete resources 成功之后 resp.Body 为空.
-	if err != nil && !errors.Is(err, io.EOF) {
-		return err
+	fmt.Fprintln(msgOut, "unused attachments:")
+	for _, id := range cleaner.SortedIDs(report.Unused) {
+		fmt.Fprintln(msgOut, "  - "+id)
 	}
+	fmt.Fprintln(msgOut, msgViewTip)
 
-	return nil
+	// -safe-delete 的第一步只是 dry run, 确认之后重新扫描.
+	if opt.Rescan {
+		var total int64
+		for _, item := range report.Unused {
+			total += item.Size
+		}
+		fmt.Fprintf(msgOut, "dry run: would free %s, attachments will be scanned again before deleting\n", cleaner.FormatBytes(total))
+	}
 }
 
-// DOC: Gets all resources.
-// https://joplinapp.org/api/references/rest_api/#get-resources
-// https://joplinapp.org/api/references/rest_api/#pagination
-// returns attachments IDs
-func getAllResources(req Req) (resourcesIDs map[string]struct{}, err error) {
-	resourcesIDs = make(map[string]struct{})
-	var mark = true
-	for page := 1; mark; page++ {
-		// GET request:
-		// - limit: max restricted to 100.
-		// - sort: by id.
-		// - page: start from 1.
-		// - fields: columns.
-		url := fmt.Sprintf("http://localhost:%d/resources?token=%s&fields=id&order_by=id&limit=100&page=%d", req.port, req.token, page)
-		var resp joplinResponse
-		err := readRespBody("GET", url, &resp)
+// 扫描并删除 unused resources, 结束时打印 summary.
+// CLI 只负责输入输出, 扫描和删除由 Client.DeleteUnused() 完成.
+func run(ctx context.Context, req cleaner.Client, opt options) (sum cleaner.Summary, err error) {
+	// stdout 只输出 json / IDs / script 时, 其他提示信息打印到 stderr.
+	var msgOut io.Writer = stdout
+	if opt.format == "json" || opt.idsOnly || opt.emitScript == "-" {
+		msgOut = os.Stderr
+	}
+
+	var printed, refused bool
+	opts := opt.Options
+	opts.Delete = !opt.idsOnly && opt.emitScript == ""
+	opts.Confirm = func(r *cleaner.Report) bool {
+		// 非交互环境 (cron, 脚本) 中默认拒绝删除, 防止配置错误的脚本误删, 需要明确使用 -yes 或 -force.
+		// 扫描和列表照常输出, 只是不删除.
+		if !opt.yes && !opt.Force && !isInteractive() {
+			printScanned(msgOut, r, opt)
+			printed, refused = true, true
+			log.Println(msgNonInteractive)
+			return false
+		}
+
+		if opt.review {
+			r.Decisions.Print(os.Stderr, opt.verbose)
+			printed = true
+			return reviewResources(os.Stdin, msgOut, r)
+		}
+
+		printScanned(msgOut, r, opt)
+		printed = true
+
+		if opt.yes {
+			return true
+		}
+
+		// prompt delete resources
+		fmt.Fprint(msgOut, "delete these resources? [Yes/no]: ")
+		stdout.Flush()
+		input, err := bufio.NewReader(os.Stdin).ReadString('\n')
 		if err != nil {
 			log.Println(err)
-			return nil, err
+			return false
 		}
+		input = strings.TrimSuffix(input, "\n")
+
+		return input == "yes" || input == "Yes"
+	}
+
+	report, err := req.DeleteUnused(ctx, opts)
+	sum = report.Summary
 
-		// joplin server return error.
-		if resp.Error != "" {
-			log.Println(resp.Error)
-			return nil, errors.New(resp.Error)
+	// 即使删除过程中出错, 也要记录每个 resource 的处理结果.
+	if opt.decisionLog != "" && report.Decisions != nil {
+		if lerr := writeDecisionLog(opt.decisionLog, &report); lerr != nil {
+			log.Println(lerr)
 		}
+	}
 
-		for _, item := range resp.Items {
-			resourcesIDs[item.ID] = struct{}{}
+	if report.Unused == nil {
+		// 扫描失败
+		return sum, err
+	}
+	if !printed {
+		printScanned(msgOut, &report, opt)
+	}
+
+	// stdout 只输出 IDs, 方便 xargs 等工具使用.
+	if opt.idsOnly {
+		for _, id := range cleaner.SortedIDs(report.Unused) {
+			fmt.Fprintln(stdout, id)
 		}
+		return sum, nil
+	}
 
-		// 判断后续是否有更多的 resources.
-		mark = resp.More
+	// 只生成删除脚本, 由用户检查之后自己执行.
+	if opt.emitScript != "" {
+		if len(report.Unused) < 1 {
+			return sum, nil
+		}
+		return sum, writeDeleteScript(opt.emitScript, req.Port, report.Unused)
 	}
 
-	return resourcesIDs, nil
-}
+	if opt.deleteReport != "" && report.Confirmed {
+		// 即使删除过程中出错, 也要记录已经删除的 resources.
+		if rerr := writeDeleteReport(opt.deleteReport, opt.format, opt.humanize, report.Deleted); rerr != nil {
+			log.Println(rerr)
+		}
+	}
 
-// DOC: Gets the notes (IDs) associated with a resource.
-// https://joplinapp.org/api/references/rest_api/#get-resources-id-notes
-func filterResources(req Req, resources map[string]struct{}) error {
-	for id := range resources {
-		url := fmt.Sprintf("http://localhost:%d/resources/%s/notes?token=%s&fields=id", req.port, id, req.token)
+	if len(report.Failures) > 0 {
+		printFailures(os.Stderr, report.Failures)
+	}
+
+	if opt.Dangling && report.Dangling != nil && opt.format != "json" {
+		printDanglingNotes(msgOut, report.Dangling)
+	}
+
+	if opt.syncAfter && len(report.Deleted) > 0 {
+		fmt.Fprintln(msgOut, msgSyncTip)
+	}
 
-		var resp joplinResponse
-		err := readRespBody("GET", url, &resp)
+	// 打印 end-of-run summary
+	switch {
+	case opt.format == "json" && err != nil:
+		// 由 failJSON() 输出 error object 和 summary.
+	case opt.format == "json":
+		err := printJSON(stdout, jsonOutput{UnusedIDs: cleaner.SortedIDs(report.Unused), Summary: sum, Failures: report.Failures, Dangling: report.Dangling})
 		if err != nil {
 			log.Println(err)
-			return err
 		}
+	case opt.quiet:
+	case opt.pretty && isTerminal(os.Stdout):
+		printPrettySummary(stdout, sum)
+	default:
+		printSummary(stdout, sum)
+	}
 
-		// joplin server return error.
-		if resp.Error != "" {
-			log.Println(resp.Error)
-			return errors.New(resp.Error)
-		}
+	if err == nil && refused {
+		return sum, errNotConfirmed
+	}
+	return sum, err
+}
 
-		// 如果 items 不存在, 说明引用该 resources 的 note 不存在.
-		if len(resp.Items) > 0 {
-			// 从 map 中删除
-			delete(resources, id)
+// -format json 时, 运行失败在 stdout 输出 error object, 保证 stdout 总是 JSON.
+// 返回 non-zero exit code, 由 main() 退出. error 总是记录到 log.
+func failJSON(opt options, phase string, err error, sum *cleaner.Summary) int {
+	logError(err)
+	if opt.format == "json" {
+		if perr := printJSON(stdout, jsonErrorOutput{Error: newJSONError(err, phase), Summary: sum}); perr != nil {
+			log.Println(perr)
 		}
 	}
-
-	return nil
+	return 1
 }
 
-// 根据 resources id 删除无用的 resources.
-// Delete "http://localhost:port/resources/:id?token=Token"
-func deleteResources(req Req, resources map[string]struct{}) error {
-	for id := range resources {
-		url := fmt.Sprintf("http://localhost:%d/resources/%s?token=%s", req.port, id, req.token)
+// cleaner 不会把返回的 error 写入 Client.Logger, 由 CLI 记录.
+func logError(err error) {
+	var pe *cleaner.PhaseError
+	if errors.As(err, &pe) && errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("%s phase timed out\n", pe.Phase)
+	}
+	log.Println(err)
+}
 
-		var resp joplinResponse
-		err := readRespBody("DELETE", url, &resp)
+// 每隔 interval 执行一次 run(), 直到收到 SIGINT / SIGTERM.
+// run() 是同步执行的, 所以不会有两次 run() 同时进行; 如果一次 run() 的耗时超过了 interval,
+// 下一次 run() 会在上一次结束之后立即开始.
+func watch(req cleaner.Client, opt options) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(opt.watch)
+	defer ticker.Stop()
+
+	for i := 1; ; i++ {
+		log.Printf("watch: iteration %d\n", i)
+		start := time.Now()
+		// 使用新的 context, SIGINT 不会中断正在进行的 run().
+		_, err := run(context.Background(), req, opt)
 		if err != nil {
-			log.Println(err)
-			return err
+			logError(err)
+			log.Printf("watch: iteration %d failed\n", i)
+		}
+		stdout.Flush()
+		if elapsed := time.Since(start); elapsed > opt.watch {
+			log.Printf("watch: iteration %d took %s, longer than interval %s\n", i, elapsed, opt.watch)
 		}
 
-		if resp.Error != "" {
-			// if error add to "failToDelete" slice.
-			log.Printf("delete %s error: %s\n", id, resp.Error)
-			return errors.New(resp.Error)
+		// SIGINT 只在两次 run() 之间生效.
+		select {
+		case <-ctx.Done():
+			log.Println("watch: stopped")
+			return
+		case <-ticker.C:
 		}
 	}
-
-	return nil
 }
 
 func main() {
+	os.Exit(realMain())
+}
+
+// main() 的内容, 返回 exit code. os.Exit() 不会执行 defers, 所以只在 main() 中调用,
+// 保证 stopProfiling(), limiter.report() 和 stdout.Flush() 在退出之前执行.
+func realMain() int {
 	log.SetFlags(log.Llongfile)
+	defer stdout.Flush()
 
-	var port = flag.Int("p", 41184, "joplin Web Clipper service port")
-	var token = flag.String("t", "", "joplin Web Clipper Authorization token")
+	if len(os.Args) > 1 && os.Args[1] == cmdResourcesUnused {
+		return resourcesUnused(os.Args[2:])
+	}
+
+	var opt options
+	var conn = connectionFlags(flag.CommandLine)
+	var listConflictsOnly = flag.Bool("list-conflicts", false, "list conflict notes and the attachments they reference, then exit")
+	var exportGraph = flag.String("export-graph", "", "print the attachment <-> note reference graph and exit: dot | json")
+	var provenance = flag.Bool("trash-provenance", false, "list unused attachments with the trashed notes that link to them, then exit")
+	var compare = flag.Bool("compare-strategies", false, "dry run, compare the unused attachments found by checking each attachment and by scanning note bodies, then exit")
+	var allowPartialPages = flag.Bool("allow-partial-pages", true, "when a page has fewer than 100 attachments but the server says it has more, keep fetching. false stops and treats it as the last page. an empty page always stops")
+	var listStateFile = flag.String("list-state-file", "", "save listing progress to this file after each page and resume from it if interrupted, the IDs of each page are appended to <file>.ids. both are removed when listing completes")
+	var metaCacheDir = flag.String("meta-cache-dir", "", "cache attachment metadata in this directory, unchanged attachments skip fetching metadata on later runs")
+	var pageByTotal = flag.Bool("page-by-total", false, "if the server reports the total number of attachments, fetch all pages concurrently instead of following has_more. ignored with -list-state-file")
+	var maxPages = flag.Int("max-pages", 0, "fail if listing attachments needs more than this many pages, 0 means unlimited")
+	flag.StringVar(&opt.format, "format", "text", "output format: text | json")
+	flag.BoolVar(&opt.quiet, "quiet", false, "don't print the end-of-run summary")
+	flag.BoolVar(&opt.pretty, "pretty-summary", false, "render the end-of-run summary in a bordered box, only works on a terminal")
+	flag.BoolVar(&opt.yes, "yes", false, "delete unused attachments without prompting, required to delete when stdin or stdout is not a terminal")
+	flag.BoolVar(&opt.review, "review", false, "review unused attachments in a line-based prompt, toggle which to delete and confirm before deleting")
+	flag.BoolVar(&opt.IncludeLocked, "include-locked", false, "also delete attachments whose file was updated in the last "+cleaner.LockedWindow.String()+", they may be in use")
+	flag.BoolVar(&opt.idsOnly, "export-ids-only", false, "print unused attachment IDs only, one per line, never delete")
+	flag.StringVar(&opt.deleteReport, "delete-report", "", "append the deleted attachments to this file, a table per run, or JSON lines with -format json")
+	flag.BoolVar(&opt.humanize, "humanize", false, "show sizes like 4.2MiB and times like '3 months ago' in text reports, json keeps raw values")
+	flag.Int64Var(&opt.MaxFree, "max-free-bytes", 0, "refuse to delete if more than this many bytes would be freed, unless -force. 0 means no limit")
+	flag.BoolVar(&opt.Force, "force", false, "delete even if safety limits are exceeded, and allow deleting when stdin or stdout is not a terminal")
+	flag.BoolVar(&opt.KeepGoing, "continue-on-error", false, "keep deleting other attachments when one fails")
+	flag.StringVar(&opt.emitScript, "emit-script", "", "write a shell script of curl DELETE commands to this file instead of deleting, \"-\" for stdout")
+	flag.StringVar(&opt.Order, "delete-order", cleaner.OrderID, "order of deleting attachments: id | size-desc, size-desc frees the most space first if interrupted")
+	flag.StringVar(&opt.BackupDir, "backup-dir", "", "download each attachment into this directory before deleting it")
+	flag.Int64Var(&opt.MaxDownloadSize, "max-download-size", 0, "with -backup-dir, keep attachments larger than this many bytes instead of deleting them without a backup. 0 means no limit")
+	flag.BoolVar(&opt.Dangling, "report-dangling-after-delete", false, "after deleting, list notes whose bodies still link to the deleted attachments")
+	flag.BoolVar(&opt.BackupAllFirst, "backup-all-first", false, "with -backup-dir, back up and verify all attachments before deleting any, a failed backup aborts the whole deletion")
+	var filterExpr = flag.String("filter-expr", "", "only include unused attachments matching this expression, eg: \"size > 1000000 && mime == 'image/png'\"")
+	var keepFile = flag.String("keep-file", "", "never delete attachments listed in this file: .csv, .json or .jsonl (eg: a -delete-report), or one ID per line with '#' comments")
+	var onlyIDs = flag.String("only-ids", "", "only delete these unused attachments, comma separated IDs, or @file to read them from a file like -keep-file")
+	var neverDeleteMime = flag.String("never-delete-mime", "", "never delete attachments of these MIME types, comma separated, eg: application/pdf,image/*")
+	flag.DurationVar(&opt.OlderThan, "older-than", 0, "only delete attachments not updated within this duration, eg: 720h")
+	flag.BoolVar(&opt.ProtectZero, "protect-zero-size", false, "never delete zero-size attachments, their file may not be synced yet")
+	flag.DurationVar(&opt.NotebookActivity, "exclude-recent-notebook-activity", 0, "keep attachments linked from notebooks with note activity within this duration, eg: 24h")
+	flag.StringVar(&opt.ProtectPath, "protect-path", "", "keep attachments linked from notes in this notebook and its sub-notebooks, by names, eg: \"Work/Clients\"")
+	flag.BoolVar(&opt.Snapshot, "snapshot", false, "read all attachments and all note bodies first, then find the unused attachments from this snapshot instead of checking each attachment")
+	flag.BoolVar(&opt.Strict, "only-delete-zero-reference", false, "only delete attachments that neither the API nor any note body references, and print where the two disagree")
+	flag.BoolVar(&opt.Rescan, "safe-delete", false, "show a dry run first, then after confirmation scan again and only delete attachments unused in both scans")
+	flag.BoolVar(&opt.Reverify, "reverify", false, "check again that an attachment is unused right before deleting it")
+	var conservative = flag.Bool("conservative", false, "safe defaults for first-time use, same as: -older-than 720h -protect-zero-size -reverify")
+	var progressJSON = flag.Bool("progress-json", false, "print progress of each phase to stderr as JSON lines, for GUI frontends")
+	flag.BoolVar(&opt.verbose, "v", false, "verbose, print why each attachment is kept or deleted")
+	flag.StringVar(&opt.decisionLog, "decision-log", "", "append one JSON line per scanned attachment to this file: metadata, the verdict of each filter, and the final decision with reason")
+	flag.DurationVar(&opt.Timeout, "timeout", 0, "deadline of a whole run, including the confirmation prompt, 0 means no deadline")
+	flag.DurationVar(&opt.ListTimeout, "list-timeout", 0, "deadline of listing attachments, 0 means inherit -timeout")
+	flag.DurationVar(&opt.FilterTimeout, "filter-timeout", 0, "deadline of checking attachment references, 0 means inherit -timeout")
+	flag.DurationVar(&opt.DeleteTimeout, "delete-timeout", 0, "deadline of deleting attachments, 0 means inherit -timeout")
+	flag.BoolVar(&opt.syncAfter, "sync-after", false, "print a reminder to sync after deleting so other devices get the deletions, the API has no sync trigger")
+	flag.DurationVar(&opt.watch, "watch", 0, "re-scan and delete every interval, eg: 1h. requires -yes")
+	var checkNewVersion = flag.Bool("check-update", false, "check GitHub for a newer release")
+	var cpuProfile = flag.String("cpuprofile", "", "write a CPU profile to this file")
+	var memProfile = flag.String("memprofile", "", "write a heap profile to this file on exit")
+	flag.Usage = usage
 	flag.Parse()
 
-	if *token == "" {
-		log.Println("token is empty")
-		return
+	stopProfiling, err := startProfiling(*cpuProfile, *memProfile)
+	if err != nil {
+		log.Println(err)
+		return 1
 	}
+	defer stopProfiling()
 
-	if *port > 65535 || *port < 0 {
-		log.Println("port is invalid")
-		return
+	if *checkNewVersion {
+		// 检查失败不影响运行.
+		if err := checkUpdate(os.Stderr); err != nil {
+			log.Println(err)
+		}
+		if *conn.token == "" && *conn.profileDir == "" {
+			return 0
+		}
 	}
 
-	req := Req{
-		port:  *port,
-		token: *token,
+	req, reportConn, err := conn.newClient()
+	if err != nil {
+		log.Println(err)
+		return 1
 	}
+	defer reportConn()
 
-	resources, err := getAllResources(req)
-	if err != nil {
-		return
+	if opt.format != "text" && opt.format != "json" {
+		log.Println("format is invalid")
+		return 1
 	}
 
-	err = filterResources(req, resources)
-	if err != nil {
-		return
+	if *exportGraph != "" && *exportGraph != "dot" && *exportGraph != "json" {
+		log.Println("export-graph is invalid")
+		return 1
 	}
 
-	if len(resources) < 1 {
-		fmt.Println("no unused attachments")
-		return
+	if opt.Order != cleaner.OrderID && opt.Order != cleaner.OrderSizeDesc {
+		log.Println("delete-order is invalid")
+		return 1
+	}
+
+	// GUI 从 stderr 中读取以 "{" 开头的行来显示进度条.
+	if *progressJSON {
+		enc := json.NewEncoder(os.Stderr)
+		opt.Progress = func(p cleaner.Progress) { enc.Encode(p) }
 	}
 
-	fmt.Println("unused attachments:")
-	for id := range resources {
-		fmt.Println("  - " + id)
+	if opt.Timeout < 0 || opt.ListTimeout < 0 || opt.FilterTimeout < 0 || opt.DeleteTimeout < 0 {
+		log.Println("timeout is invalid")
+		return 1
 	}
-	fmt.Println("view these attachments in 'Tools > Note attachments'")
 
-	// prompt delete resources
-	fmt.Print("delete these resources? [Yes/no]: ")
-	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if opt.OlderThan < 0 {
+		log.Println("older-than is invalid")
+		return 1
+	}
+
+	// -conservative 只是几个 options 的组合:
+	//   - -older-than 720h: 只删除 30 天内没有更新过的 resources, 已设置了更长的时间则保留.
+	//   - -protect-zero-size: 不删除 size 为 0 的 resources.
+	//   - -reverify: 删除前重新检查 resource 是否被引用.
+	if *conservative {
+		opt.OlderThan = max(opt.OlderThan, conservativeAge)
+		opt.ProtectZero = true
+		opt.Reverify = true
+	}
+
+	if opt.NotebookActivity < 0 {
+		log.Println("exclude-recent-notebook-activity is invalid")
+		return 1
+	}
+
+	if opt.MaxFree < 0 {
+		log.Println("max-free-bytes is invalid")
+		return 1
+	}
+
+	if opt.watch < 0 {
+		log.Println("watch interval is invalid")
+		return 1
+	}
+
+	if opt.watch > 0 && (opt.idsOnly || opt.emitScript != "") {
+		log.Println("-watch can't be used with -export-ids-only or -emit-script")
+		return 1
+	}
+
+	if opt.watch > 0 && !opt.yes {
+		log.Println("-watch requires -yes")
+		return 1
+	}
+
+	if opt.review && (opt.yes || opt.idsOnly || opt.emitScript != "") {
+		log.Println("-review can't be used with -yes, -export-ids-only or -emit-script")
+		return 1
+	}
+
+	if *filterExpr != "" {
+		e, err := cleaner.ParseExpr(*filterExpr)
+		if err != nil {
+			log.Println("filter-expr is invalid:", err)
+			return 1
+		}
+		opt.Filter = e
+	}
+
+	for _, m := range strings.Split(*neverDeleteMime, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			opt.NeverDeleteMimes = append(opt.NeverDeleteMimes, m)
+		}
+	}
+
+	// IDs 可以是 bare ID, ":/<id>", markdown link 或者 URL, 见 parseResourceID().
+	if *keepFile != "" {
+		ids, err := readResourceIDFile(*keepFile)
+		if err != nil {
+			log.Println("keep-file is invalid:", err)
+			return 1
+		}
+		opt.KeepIDs = ids
+	}
+
+	if *onlyIDs != "" {
+		var ids []string
+		var err error
+		if path, ok := strings.CutPrefix(*onlyIDs, "@"); ok {
+			ids, err = readResourceIDFile(path)
+		} else {
+			ids, err = parseResourceIDList(*onlyIDs)
+		}
+		if err != nil {
+			log.Println("only-ids is invalid:", err)
+			return 1
+		}
+		opt.OnlyIDs = ids
+	}
+
+	if *metaCacheDir != "" {
+		if err := os.MkdirAll(*metaCacheDir, 0o755); err != nil {
+			log.Println(err)
+			return 1
+		}
+	}
+
+	if opt.MaxDownloadSize < 0 {
+		log.Println("max-download-size is invalid")
+		return 1
+	}
+
+	if opt.Snapshot && opt.Strict {
+		log.Println("-snapshot can't be used with -only-delete-zero-reference, the snapshot already uses note bodies")
+		return 1
+	}
+
+	if opt.BackupAllFirst && opt.BackupDir == "" {
+		log.Println("-backup-all-first requires -backup-dir")
+		return 1
+	}
+
+	if opt.BackupDir != "" {
+		if err := os.MkdirAll(opt.BackupDir, 0o755); err != nil {
+			log.Println(err)
+			return 1
+		}
+	}
+
+	if *maxPages < 0 {
+		log.Println("max-pages is invalid")
+		return 1
+	}
+
+	if opt.watch == 0 {
+		flushOnInterrupt()
+	}
+
+	ctx := context.Background()
+	req.MaxPages = *maxPages
+	req.StopOnPartialPage = !*allowPartialPages
+	req.ListStateFile = *listStateFile
+	req.MetaCacheDir = *metaCacheDir
+	req.PageByTotal = *pageByTotal
+
+	req.Server, err = req.Probe(ctx)
 	if err != nil {
-		log.Println(err)
-		return
+		return failJSON(opt, "connect", err, nil)
 	}
-	input = strings.TrimSuffix(input, "\n")
 
-	if input != "yes" && input != "Yes" {
-		return
+	if req.Concurrency == 0 {
+		req.Concurrency = req.ProbeConcurrency(ctx)
+		log.Printf("concurrency: %d\n", req.Concurrency)
+	}
+
+	if *listConflictsOnly {
+		conflicts, err := req.ListConflicts(ctx)
+		if err != nil {
+			return failJSON(opt, "list-conflicts", err, nil)
+		}
+
+		if opt.format == "json" {
+			if err = printJSON(stdout, conflicts); err != nil {
+				log.Println(err)
+			}
+			return 0
+		}
+		printConflicts(stdout, conflicts)
+		return 0
+	}
+
+	if *exportGraph != "" {
+		nodes, err := req.BuildGraph(ctx)
+		if err != nil {
+			return failJSON(opt, "export-graph", err, nil)
+		}
+
+		if *exportGraph == "json" {
+			if err = printJSON(stdout, nodes); err != nil {
+				log.Println(err)
+			}
+			return 0
+		}
+		printGraphDOT(stdout, nodes)
+		return 0
+	}
+
+	if *provenance {
+		report, err := req.DeleteUnused(ctx, opt.Options)
+		if err != nil {
+			return failJSON(opt, "", err, nil)
+		}
+
+		orphans, err := req.TrashProvenance(ctx, report.Unused)
+		if err != nil {
+			return failJSON(opt, "trash-provenance", err, nil)
+		}
+
+		if opt.format == "json" {
+			if err = printJSON(stdout, orphans); err != nil {
+				log.Println(err)
+			}
+			return 0
+		}
+		printTrashProvenance(stdout, orphans)
+		return 0
 	}
 
-	err = deleteResources(req, resources)
+	if *compare {
+		diff, err := req.CompareStrategies(ctx)
+		if err != nil {
+			return failJSON(opt, "compare-strategies", err, nil)
+		}
+
+		if opt.format == "json" {
+			if err = printJSON(stdout, diff); err != nil {
+				log.Println(err)
+			}
+			return 0
+		}
+		printStrategyDiff(stdout, diff)
+		return 0
+	}
+
+	if opt.watch > 0 {
+		watch(req, opt)
+		return 0
+	}
+
+	sum, err := run(ctx, req, opt)
+	if errors.Is(err, errNotConfirmed) {
+		return exitNotConfirmed
+	}
 	if err != nil {
-		return
+		// scanned 为 0 说明 listing 都没有完成, 没有 summary 可以输出.
+		var partial *cleaner.Summary
+		if sum.Scanned > 0 {
+			partial = &sum
+		}
+		return failJSON(opt, "output", err, partial)
 	}
+	return 0
 }
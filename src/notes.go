@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"local/src/cleaner"
+)
+
+func printConflicts(w io.Writer, conflicts []cleaner.ConflictNote) {
+	if len(conflicts) < 1 {
+		fmt.Fprintln(w, "no conflict notes")
+		return
+	}
+
+	for _, c := range conflicts {
+		fmt.Fprintf(w, "%s %q (%d attachments)\n", c.ID, c.Title, len(c.Resources))
+		for _, r := range c.Resources {
+			fmt.Fprintf(w, "  - %s %s\n", r.ID, r.Title)
+		}
+	}
+}
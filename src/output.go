@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// 输出到 stdout 的内容先写入 buffer, 大量输出 (eg: -export-ids-only | xargs) 时减少 syscall.
+// 在 prompt 之前, -watch 每次 run() 之后, 退出时以及收到 interrupt 时 flush.
+var stdout = &syncWriter{w: bufio.NewWriter(os.Stdout)}
+
+// signal handler 和正常输出可能在不同的 goroutine 中, 需要加锁.
+type syncWriter struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *syncWriter) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Flush()
+}
+
+// 收到 SIGINT / SIGTERM 时 flush stdout 然后退出, 不丢失 buffer 中的内容.
+// -watch 自己处理 signal, 在两次 run() 之间退出, 不需要这个.
+func flushOnInterrupt() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		stdout.Flush()
+		os.Exit(130)
+	}()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// maintainers 使用的 flags, 不在 -h 中显示.
+var hiddenFlags = map[string]bool{
+	"cpuprofile": true,
+	"memprofile": true,
+}
+
+// 同 flag 默认的 Usage, 但不显示 hiddenFlags.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(out, "  %s [flags]\n", os.Args[0])
+	fmt.Fprintf(out, "  %s %s [flags]\n\tonly print unused attachments, see '%s %s -h'\n\n", os.Args[0], cmdResourcesUnused, os.Args[0], cmdResourcesUnused)
+
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(out)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+			// 解析出错时 f.Value 可能已经被修改了.
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
+
+	fmt.Fprintln(out, "\nDeleting needs a terminal on stdin and stdout to confirm.")
+	fmt.Fprintln(out, "In scripts and cron jobs, pass -yes (or -force) to delete non-interactively.")
+	fmt.Fprintf(out, "Otherwise nothing is deleted and the exit code is %d.\n", exitNotConfirmed)
+}
+
+// 开始 CPU profiling, 返回的 stop 结束 CPU profiling 并写入 heap profile.
+// 文件名为空表示不需要对应的 profile.
+func startProfiling(cpuFile, memFile string) (stop func(), err error) {
+	var cpu *os.File
+	if cpuFile != "" {
+		cpu, err = os.Create(cpuFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, err
+		}
+	}
+
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+		}
+
+		if memFile == "" {
+			return
+		}
+		f, err := os.Create(memFile)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer f.Close()
+
+		runtime.GC() // 只统计仍在使用的内存.
+		if err = pprof.WriteHeapProfile(f); err != nil {
+			log.Println(err)
+		}
+	}, nil
+}
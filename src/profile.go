@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Joplin desktop 的 profile 目录中保存 settings 的文件,
+// eg: ~/.config/joplin-desktop/settings.json
+const profileSettingsFile = "settings.json"
+
+// Web Clipper service 相关的 settings.
+type profileSettings struct {
+	Token string `json:"api.token"`
+	Port  int    `json:"api.port"` // 没有修改过默认端口时不存在
+}
+
+// 从 Joplin desktop 的 profile 目录中读取 Web Clipper 的 token 和 port.
+func readProfileSettings(dir string) (profileSettings, error) {
+	var s profileSettings
+
+	path := filepath.Join(dir, profileSettingsFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("read joplin profile: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	// Web Clipper service 从来没有启用过时没有 token.
+	if s.Token == "" {
+		return s, fmt.Errorf("%s has no api.token, enable the Web Clipper service in Joplin first", path)
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		return s, errors.New(path + " has an invalid api.port")
+	}
+
+	return s, nil
+}
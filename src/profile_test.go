@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadProfileSettings(t *testing.T) {
+	for _, tc := range []struct {
+		content string
+		want    profileSettings
+		err     string
+	}{
+		{content: `{"api.token": "abc", "api.port": 41185, "locale": "en_GB"}`, want: profileSettings{Token: "abc", Port: 41185}},
+		{content: `{"api.token": "abc"}`, want: profileSettings{Token: "abc"}},
+		{content: `{"locale": "en_GB"}`, err: "no api.token"},
+		{content: `{"api.token": `, err: "parse"},
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, profileSettingsFile), []byte(tc.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readProfileSettings(dir)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: got error %v, want %q", tc.content, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.content, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.content, got, tc.want)
+		}
+	}
+
+	if _, err := readProfileSettings(t.TempDir()); err == nil {
+		t.Error("missing settings.json should fail")
+	}
+}
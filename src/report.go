@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"local/src/cleaner"
+)
+
+// 记录本次运行实际删除的 resources, 追加到文件末尾, 所以 -watch 的每次运行都会被保留.
+//   - text: 对齐的表格, 每次运行一个表格. humanize 时 size 和 time 使用 cleaner.FormatBytes() 和 humanTime()
+//   - json: JSON lines, 每行一个 cleaner.DeleteRecord, 总是使用原始值
+func writeDeleteReport(path, format string, humanize bool, deleted []cleaner.DeleteRecord) error {
+	f, err := openAppend(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == "json" {
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		for _, r := range deleted {
+			if err = enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	if len(deleted) < 1 {
+		return f.Close()
+	}
+
+	tw := tabwriter.NewWriter(f, 0, 0, 2, ' ', 0)
+	now := time.Now()
+	fmt.Fprintln(tw, "ID\tTITLE\tSIZE\tMIME\tCREATED\tUPDATED\tDELETED AT")
+	for _, r := range deleted {
+		size := fmt.Sprint(r.Size)
+		created, updated := fmt.Sprint(r.CreatedTime), fmt.Sprint(r.UpdatedTime)
+		deletedAt := r.DeletedAt.Format(time.RFC3339)
+		if humanize {
+			size = cleaner.FormatBytes(r.Size)
+			created = humanTime(time.UnixMilli(r.CreatedTime), now)
+			updated = humanTime(time.UnixMilli(r.UpdatedTime), now)
+			deletedAt = humanTime(r.DeletedAt, now)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.Title, size, r.Mime, created, updated, deletedAt)
+	}
+	fmt.Fprintln(tw)
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// 文件不存在时创建, 已存在时追加, 不会覆盖之前的内容.
+func openAppend(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+}
+
+// 按照失败原因分组打印.
+func printFailures(w io.Writer, failed []cleaner.DeleteFailure) {
+	var causes []string
+	groups := make(map[string][]cleaner.DeleteFailure)
+	for _, f := range failed {
+		if _, ok := groups[f.Cause]; !ok {
+			causes = append(causes, f.Cause)
+		}
+		groups[f.Cause] = append(groups[f.Cause], f)
+	}
+
+	fmt.Fprintf(w, "failed to delete %d attachments:\n", len(failed))
+	for _, cause := range causes {
+		fmt.Fprintf(w, "  %s (%d):\n", cause, len(groups[cause]))
+		for _, f := range groups[cause] {
+			fmt.Fprintf(w, "    - %s [%d %s] %s\n", f.ID, f.Status, f.Endpoint, f.Error)
+		}
+	}
+}
+
+// -decision-log 中的一行.
+type decisionLogLine struct {
+	cleaner.Item
+	Notes    int               `json:"notes"` // reference check 的结果
+	Verdicts []cleaner.Verdict `json:"verdicts"`
+	Decision string            `json:"decision"` // kept | deleted | failed | unused (没有删除, eg: dry run 或者取消)
+	Reason   string            `json:"reason"`
+	LoggedAt time.Time         `json:"logged_at"` // 同一次运行的所有行相同, 用于区分 -watch 的每次运行
+}
+
+// 每个扫描过的 resource 一行 JSON, 按 ID 排序, 追加到文件末尾. verbose 输出的结构化版本.
+func writeDecisionLog(path string, r *cleaner.Report) error {
+	f, err := openAppend(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	deleted := make(map[string]bool, len(r.Deleted))
+	for _, rec := range r.Deleted {
+		deleted[rec.ID] = true
+	}
+	failed := make(map[string]string, len(r.Failures))
+	for _, fl := range r.Failures {
+		failed[fl.ID] = fl.Error
+	}
+
+	ids := make([]string, 0, len(r.Decisions))
+	for id := range r.Decisions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	now := time.Now()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, id := range ids {
+		dc := r.Decisions[id]
+		line := decisionLogLine{Item: dc.Item, Notes: dc.Notes, Verdicts: dc.Verdicts, Reason: dc.Reason, LoggedAt: now}
+		line.ID = id
+
+		switch {
+		case dc.Keep:
+			line.Decision = "kept"
+		case deleted[id]:
+			line.Decision = "deleted"
+		case failed[id] != "":
+			line.Decision, line.Reason = "failed", failed[id]
+		default:
+			line.Decision = "unused"
+		}
+
+		if err = enc.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// 生成 curl -X DELETE 脚本, 不会执行. token 不会写入脚本, 运行时通过 JOPLIN_TOKEN 环境变量提供.
+// path 为 "-" 时输出到 stdout.
+func writeDeleteScript(path string, port int, resources map[string]cleaner.Item) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# Generated by joplin-attachment-cleaner, it is NOT run automatically.\n")
+	fmt.Fprintf(&b, "# Review it first, it deletes %d unused attachments from the Joplin Web Clipper service.\n", len(resources))
+	b.WriteString("# The token is redacted, provide it when running:\n")
+	b.WriteString("#   JOPLIN_TOKEN=<your token> sh <this script>\n")
+	b.WriteString("set -eu\n")
+	b.WriteString(": \"${JOPLIN_TOKEN:?set JOPLIN_TOKEN to your Joplin Web Clipper token}\"\n")
+
+	for _, id := range cleaner.SortedIDs(resources) {
+		item := resources[id]
+		// title 中的换行会破坏注释.
+		title := strings.Join(strings.Fields(item.Title), " ")
+		fmt.Fprintf(&b, "\n# %s (%s)\n", title, cleaner.FormatBytes(item.Size))
+		fmt.Fprintf(&b, "curl -fsS -X DELETE \"http://localhost:%d/resources/%s?token=${JOPLIN_TOKEN}\"\n", port, id)
+	}
+
+	if path == "-" {
+		_, err := io.WriteString(stdout, b.String())
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"local/src/cleaner"
+)
+
+// -review 的命令说明.
+const reviewHelp = `commands:
+  3 1-5 ...  toggle keep / delete of these items
+  a / n      select all / none for deleting
+  i 3        show metadata of item 3
+  l          list again
+  d          done, confirm and delete the selected items
+  q          quit without deleting anything`
+
+// -review: 逐项 review unused resources, 选择要删除的 resources, 确认之后才删除.
+// 没有依赖 terminal library, 使用按行输入的命令, 所以也可以通过 pipe 输入.
+// 没有被选中的 resources 从 r.Unused 中移除, 记录为 kept.
+// 返回 false 表示取消, 不删除任何 resource.
+func reviewResources(in io.Reader, out io.Writer, r *cleaner.Report) bool {
+	ids := cleaner.SortedIDs(r.Unused)
+	selected := make([]bool, len(ids))
+	for i := range selected {
+		selected[i] = true
+	}
+
+	scanner := bufio.NewScanner(in)
+	printReviewList(out, r.Unused, ids, selected)
+	fmt.Fprintln(out, reviewHelp)
+
+	for {
+		fmt.Fprint(out, "review> ")
+		flushWriter(out)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return false
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 {
+			continue
+		}
+
+		switch fields[0] {
+		case "q":
+			return false
+		case "a", "n":
+			for i := range selected {
+				selected[i] = fields[0] == "a"
+			}
+			printReviewList(out, r.Unused, ids, selected)
+		case "l":
+			printReviewList(out, r.Unused, ids, selected)
+		case "i":
+			for _, f := range fields[1:] {
+				idx, err := parseReviewIndexes(f, len(ids))
+				if err != nil {
+					fmt.Fprintln(out, err)
+					continue
+				}
+				for _, i := range idx {
+					printReviewItem(out, r.Unused[ids[i]])
+				}
+			}
+		case "d":
+			n, size := 0, int64(0)
+			for i, id := range ids {
+				if selected[i] {
+					n++
+					size += r.Unused[id].Size
+				}
+			}
+			if n == 0 {
+				fmt.Fprintln(out, "nothing selected, use q to quit")
+				continue
+			}
+
+			fmt.Fprintf(out, "delete %d attachments, %s? [Yes/no]: ", n, cleaner.FormatBytes(size))
+			flushWriter(out)
+			if !scanner.Scan() {
+				fmt.Fprintln(out)
+				return false
+			}
+			if input := strings.TrimSpace(scanner.Text()); input != "yes" && input != "Yes" {
+				continue
+			}
+
+			for i, id := range ids {
+				if !selected[i] {
+					r.Decisions.Keep(r.Unused, id, "deselected in review")
+				}
+			}
+			r.Summary.Unused = len(r.Unused)
+			return true
+		default:
+			// 先检查所有 items, 有一个无效时整行都不生效, 不会只切换一部分.
+			var toggle []int
+			var err error
+			for _, f := range fields {
+				var idx []int
+				if idx, err = parseReviewIndexes(f, len(ids)); err != nil {
+					break
+				}
+				toggle = append(toggle, idx...)
+			}
+			if err != nil {
+				fmt.Fprintln(out, err)
+				fmt.Fprintln(out, reviewHelp)
+				continue
+			}
+
+			for _, i := range toggle {
+				selected[i] = !selected[i]
+			}
+			printReviewList(out, r.Unused, ids, selected)
+		}
+	}
+}
+
+func printReviewList(out io.Writer, resources map[string]cleaner.Item, ids []string, selected []bool) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tDELETE\tID\tTITLE\tMIME\tSIZE")
+	var n int
+	for i, id := range ids {
+		mark := "[ ]"
+		if selected[i] {
+			mark = "[x]"
+			n++
+		}
+		item := resources[id]
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, mark, id, item.Title, item.Mime, cleaner.FormatBytes(item.Size))
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "%d of %d selected for deleting\n", n, len(ids))
+}
+
+func printReviewItem(out io.Writer, item cleaner.Item) {
+	now := time.Now()
+	fmt.Fprintf(out, "%s\n  title:   %s\n  mime:    %s\n  size:    %s (%d bytes)\n  created: %s\n  updated: %s\n",
+		item.ID, item.Title, item.Mime, cleaner.FormatBytes(item.Size), item.Size,
+		humanTime(time.UnixMilli(item.CreatedTime), now), humanTime(time.UnixMilli(item.UpdatedTime), now))
+}
+
+// "3" 或者 "1-5", 从 1 开始. 返回从 0 开始的 indexes.
+func parseReviewIndexes(s string, n int) ([]int, error) {
+	from, to, isRange := strings.Cut(s, "-")
+	start, err := strconv.Atoi(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid item %q", s)
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.Atoi(to); err != nil {
+			return nil, fmt.Errorf("invalid item %q", s)
+		}
+	}
+	if start < 1 || end > n || start > end {
+		return nil, fmt.Errorf("item %q out of range 1-%d", s, n)
+	}
+
+	var idx []int
+	for i := start; i <= end; i++ {
+		idx = append(idx, i-1)
+	}
+	return idx, nil
+}
+
+// prompt 之前需要 flush buffered stdout.
+func flushWriter(w io.Writer) {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+}
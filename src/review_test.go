@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"local/src/cleaner"
+)
+
+func TestReviewResources(t *testing.T) {
+	newReport := func() *cleaner.Report {
+		r := &cleaner.Report{Unused: make(map[string]cleaner.Item), Decisions: make(cleaner.Decisions)}
+		for _, id := range []string{"a", "b", "c", "d"} {
+			r.Unused[id] = cleaner.Item{ID: id, Size: 10}
+		}
+		r.Decisions.MarkDeletes(r.Unused)
+		return r
+	}
+
+	for _, tc := range []struct {
+		name    string
+		input   string
+		confirm bool
+		want    string // IDs left in Unused
+	}{
+		{name: "toggle", input: "2 3-4\n3\nd\nyes\n", confirm: true, want: "ac"},
+		{name: "none then one", input: "n\n4\nd\nYes\n", confirm: true, want: "d"},
+		{name: "declined confirm then quit", input: "d\nno\nq\n", confirm: false, want: "abcd"},
+		{name: "eof", input: "1\n", confirm: false, want: "abcd"},
+		{name: "invalid item", input: "9 x\nd\nyes\n", confirm: true, want: "abcd"},
+		{name: "valid then invalid item", input: "1 2 x\nd\nyes\n", confirm: true, want: "abcd"},
+	} {
+		r := newReport()
+		got := reviewResources(strings.NewReader(tc.input), io.Discard, r)
+		if got != tc.confirm {
+			t.Errorf("%s: confirmed %v, want %v", tc.name, got, tc.confirm)
+		}
+		if ids := strings.Join(cleaner.SortedIDs(r.Unused), ""); ids != tc.want {
+			t.Errorf("%s: unused %s, want %s", tc.name, ids, tc.want)
+		}
+		if tc.confirm && r.Summary.Unused != len(tc.want) {
+			t.Errorf("%s: summary unused %d, want %d", tc.name, r.Summary.Unused, len(tc.want))
+		}
+	}
+}
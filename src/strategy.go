@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"local/src/cleaner"
+)
+
+func printStrategyDiff(w io.Writer, diff cleaner.StrategyDiff) {
+	fmt.Fprintf(w, "scanned: %d, unused by both strategies: %d\n", diff.Scanned, diff.Unused)
+	if len(diff.OnlyResource) == 0 && len(diff.OnlyNotes) == 0 {
+		fmt.Fprintln(w, "no differences")
+		return
+	}
+
+	fmt.Fprintf(w, "unused only by per-resource strategy (%d):\n", len(diff.OnlyResource))
+	for _, id := range diff.OnlyResource {
+		fmt.Fprintln(w, "  - "+id)
+	}
+	fmt.Fprintf(w, "unused only by notes-centric strategy (%d):\n", len(diff.OnlyNotes))
+	for _, id := range diff.OnlyNotes {
+		fmt.Fprintln(w, "  - "+id)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"local/src/cleaner"
+)
+
+// -format json 时 stdout 输出的内容.
+type jsonOutput struct {
+	UnusedIDs []string                `json:"unused_ids"`
+	Summary   cleaner.Summary         `json:"summary"`
+	Failures  []cleaner.DeleteFailure `json:"failures,omitempty"`
+	Dangling  []cleaner.DanglingNote  `json:"dangling_notes,omitempty"`
+}
+
+// -format json 时, 运行失败在 stdout 输出的内容.
+type jsonErrorOutput struct {
+	Error   jsonError        `json:"error"`
+	Summary *cleaner.Summary `json:"summary,omitempty"` // 出错之前的结果, 扫描之前出错时为 nil
+}
+
+type jsonError struct {
+	Code    string `json:"code"` // auth | not_found | api | timeout | canceled | connection | error
+	Message string `json:"message"`
+	Phase   string `json:"phase"` // connect | list | filter | delete | output, 或者其他 mode 的名字
+}
+
+// phase 为 err 中没有 cleaner.PhaseError 时使用的默认值.
+func newJSONError(err error, phase string) jsonError {
+	var pe *cleaner.PhaseError
+	if errors.As(err, &pe) {
+		phase = pe.Phase
+	}
+	return jsonError{Code: errorCode(err), Message: err.Error(), Phase: phase}
+}
+
+func errorCode(err error) string {
+	var ae *cleaner.APIError
+	var ne net.Error
+	switch {
+	case errors.As(err, &ae):
+		switch ae.Status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "auth"
+		case http.StatusNotFound:
+			return "not_found"
+		}
+		return "api"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &ne):
+		return "connection"
+	}
+	return "error"
+}
+
+// printSummary() 和 printPrettySummary() 共用的 label / value.
+func summaryRows(s cleaner.Summary) [][2]string {
+	return [][2]string{
+		{"scanned", fmt.Sprint(s.Scanned)},
+		{"unused", fmt.Sprint(s.Unused)},
+		{"deleted", fmt.Sprint(s.Deleted)},
+		{"failed", fmt.Sprint(s.Failed)},
+		{"freed", cleaner.FormatBytes(s.Freed)},
+		{"listing", s.Phases.List.Round(time.Millisecond).String()},
+		{"filtering", s.Phases.Filter.Round(time.Millisecond).String()},
+		{"deleting", s.Phases.Delete.Round(time.Millisecond).String()},
+	}
+}
+
+// one line summary, eg: "scanned: 120, unused: 3, deleted: 3, failed: 0, freed: 4.2MiB, listing: 12ms, filtering: 1.5s, deleting: 40ms"
+func printSummary(w io.Writer, s cleaner.Summary) {
+	var parts []string
+	for _, r := range summaryRows(s) {
+		parts = append(parts, r[0]+": "+r[1])
+	}
+	fmt.Fprintln(w, strings.Join(parts, ", "))
+}
+
+// 在边框中打印 summary, label 左对齐.
+//
+//	┌─────────────────┐
+//	│ scanned  120    │
+//	│ freed    4.2MiB │
+//	└─────────────────┘
+func printPrettySummary(w io.Writer, s cleaner.Summary) {
+	rows := summaryRows(s)
+
+	var labelWidth, valueWidth int
+	for _, r := range rows {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(r[0]))
+		valueWidth = max(valueWidth, utf8.RuneCountInString(r[1]))
+	}
+	inner := labelWidth + valueWidth + 4 // 左右 padding + label/value 间隔
+
+	fmt.Fprintln(w, "┌"+strings.Repeat("─", inner)+"┐")
+	for _, r := range rows {
+		fmt.Fprintf(w, "│ %-*s  %-*s │\n", labelWidth, r[0], valueWidth, r[1])
+	}
+	fmt.Fprintln(w, "└"+strings.Repeat("─", inner)+"┘")
+}
+
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// eg: "just now", "5 minutes ago", "3 months ago". 一个月按 30 天, 一年按 365 天计算.
+// zero time 和 unix 0 (joplin 没有返回该字段) 返回 "-".
+func humanTime(t, now time.Time) string {
+	if t.IsZero() || t.UnixMilli() == 0 {
+		return "-"
+	}
+
+	d := now.Sub(t)
+	if d < time.Minute {
+		return "just now"
+	}
+
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, u := range units {
+		if n := int(d / u.d); n >= 1 {
+			if n == 1 {
+				return "1 " + u.name + " ago"
+			}
+			return fmt.Sprintf("%d %ss ago", n, u.name)
+		}
+	}
+	return "just now"
+}
+
+// 删除之前需要用户确认, stdin 和 stdout 都是 terminal 才能确认.
+func isInteractive() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stdout)
+}
+
+// stdout 被 pipe 或者重定向到文件时返回 false.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"local/src/cleaner"
+)
+
+func TestHumanTime(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		t    time.Time
+		want string
+	}{
+		{now, "just now"},
+		{now.Add(-59 * time.Second), "just now"},
+		{now.Add(time.Hour), "just now"}, // 时钟偏差导致的未来时间
+		{now.Add(-time.Minute), "1 minute ago"},
+		{now.Add(-2 * time.Minute), "2 minutes ago"},
+		{now.Add(-119 * time.Minute), "1 hour ago"},
+		{now.Add(-2 * time.Hour), "2 hours ago"},
+		{now.Add(-24 * time.Hour), "1 day ago"},
+		{now.Add(-30 * 24 * time.Hour), "1 month ago"},
+		{now.Add(-61 * 24 * time.Hour), "2 months ago"},
+		{now.Add(-365 * 24 * time.Hour), "1 year ago"},
+		{now.Add(-2 * 365 * 24 * time.Hour), "2 years ago"},
+		{time.UnixMilli(0), "-"},
+		{time.Time{}, "-"},
+	} {
+		if got := humanTime(tc.t, now); got != tc.want {
+			t.Errorf("humanTime(%s): got %q, want %q", tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestNewJSONError(t *testing.T) {
+	err := &cleaner.PhaseError{Phase: "list", Err: &cleaner.APIError{Status: http.StatusForbidden}}
+	got := newJSONError(err, "connect")
+	if got.Code != "auth" || got.Phase != "list" {
+		t.Errorf("got %+v, want code auth in phase list", got)
+	}
+
+	got = newJSONError(errors.New("x"), "connect")
+	if got.Code != "error" || got.Phase != "connect" {
+		t.Errorf("got %+v, want code error in phase connect", got)
+	}
+}
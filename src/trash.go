@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"local/src/cleaner"
+)
+
+func printTrashProvenance(w io.Writer, orphans []cleaner.OrphanProvenance) {
+	if len(orphans) < 1 {
+		fmt.Fprintln(w, msgNoUnused)
+		return
+	}
+
+	for _, o := range orphans {
+		fmt.Fprintf(w, "%s %q (%s)\n", o.ID, o.Title, cleaner.FormatBytes(o.Size))
+		if len(o.TrashedNotes) < 1 {
+			fmt.Fprintln(w, "  no trashed notes link to it")
+			continue
+		}
+		for _, n := range o.TrashedNotes {
+			fmt.Fprintf(w, "  - trashed note %s %q, deleted at %s\n", n.ID, n.Title, n.DeletedTime.Format(time.RFC3339))
+		}
+	}
+}
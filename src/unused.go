@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"text/tabwriter"
+
+	"local/src/cleaner"
+)
+
+// subcommand, 只检测并打印 unused resources.
+const cmdResourcesUnused = "resources-unused"
+
+// `resources-unused`: 只读的检测命令, 打印没有被任何 note 引用的 resources.
+// 不经过 filters, 不删除, 不需要确认, 也没有备份等删除相关的逻辑. 返回 exit code.
+func resourcesUnused(args []string) int {
+	fs := flag.NewFlagSet(cmdResourcesUnused, flag.ExitOnError)
+	var conn = connectionFlags(fs)
+	var metadata = fs.Bool("metadata", false, "also fetch and print title, mime and size of each attachment")
+	var format = fs.String("format", "text", "output format: text | json")
+	fs.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		log.Println("format is invalid")
+		return 1
+	}
+
+	req, reportConn, err := conn.newClient()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer reportConn()
+
+	ctx := context.Background()
+	opt := options{format: *format}
+	req.Server, err = req.Probe(ctx)
+	if err != nil {
+		return failJSON(opt, "connect", err, nil)
+	}
+
+	if req.Concurrency == 0 {
+		req.Concurrency = req.ProbeConcurrency(ctx)
+	}
+
+	unused, err := req.FindUnused(ctx, *metadata)
+	if err != nil {
+		return failJSON(opt, cmdResourcesUnused, err, nil)
+	}
+
+	if *format == "json" {
+		err = printUnusedJSON(stdout, unused, *metadata)
+	} else {
+		err = printUnused(stdout, unused, *metadata)
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// 每行一个 ID; metadata 时为对齐的表格.
+func printUnused(w io.Writer, unused map[string]cleaner.Item, metadata bool) error {
+	if !metadata {
+		for _, id := range cleaner.SortedIDs(unused) {
+			fmt.Fprintln(w, id)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tMIME\tSIZE")
+	for _, id := range cleaner.SortedIDs(unused) {
+		item := unused[id]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", id, item.Title, item.Mime, item.Size)
+	}
+	return tw.Flush()
+}
+
+// array of IDs; metadata 时为 array of resources.
+func printUnusedJSON(w io.Writer, unused map[string]cleaner.Item, metadata bool) error {
+	if !metadata {
+		return printJSON(w, cleaner.SortedIDs(unused))
+	}
+
+	items := make([]cleaner.Item, 0, len(unused))
+	for _, id := range cleaner.SortedIDs(unused) {
+		items = append(items, unused[id])
+	}
+	return printJSON(w, items)
+}
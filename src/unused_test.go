@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"local/src/cleaner"
+)
+
+func TestPrintUnused(t *testing.T) {
+	unused := map[string]cleaner.Item{
+		"b": {ID: "b", Title: "title b", Mime: "image/png", Size: 2},
+		"a": {ID: "a", Title: "title a", Mime: "application/pdf", Size: 1},
+	}
+
+	var b strings.Builder
+	if err := printUnused(&b, unused, false); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "a\nb\n" {
+		t.Errorf("got %q, want sorted IDs", b.String())
+	}
+
+	b.Reset()
+	if err := printUnused(&b, unused, true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "title a") || !strings.Contains(lines[2], "image/png") {
+		t.Errorf("got:\n%s", b.String())
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// set by: go build -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+const latestReleaseURL = "https://api.github.com/repos/crazytaxi824/joplin-attachment-cleaner/releases/latest"
+
+// DOC: Get the latest release.
+// https://docs.github.com/en/rest/releases/releases#get-the-latest-release
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// 查询最新的 release, 只提示, 不会自动安装.
+func checkUpdate(w io.Writer) error {
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(latestReleaseURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("check update: %s", resp.Status)
+	}
+
+	var r githubRelease
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+
+	switch {
+	case version == "dev":
+		fmt.Fprintf(w, "latest version is %s: %s (current build has no version)\n", r.TagName, r.HTMLURL)
+	case newerVersion(r.TagName, version):
+		fmt.Fprintf(w, "new version %s is available (current %s): %s\n", r.TagName, version, r.HTMLURL)
+	default:
+		fmt.Fprintf(w, "%s is the latest version\n", version)
+	}
+	return nil
+}
+
+// "v1.10.0" > "v1.9.2"
+func newerVersion(latest, current string) bool {
+	l, c := versionNumbers(latest), versionNumbers(current)
+	for i := 0; i < max(len(l), len(c)); i++ {
+		var a, b int
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(c) {
+			b = c[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+// "v1.2.3-rc1" -> [1 2 3]
+func versionNumbers(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "-")
+
+	var nums []int
+	for _, s := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			break
+		}
+		nums = append(nums, n)
+	}
+	return nums
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.10.0", "v1.9.2", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.2", "v1.2.1", false},
+		{"v2.0.0", "1.99.99", true},
+		{"v1.3.0-rc1", "v1.2.9", true},
+	}
+	for _, tt := range tests {
+		if got := newerVersion(tt.latest, tt.current); got != tt.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}